@@ -1,6 +1,7 @@
 package swell
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/lienkolabs/swell/crypto"
@@ -10,50 +11,137 @@ import (
 const Version = 0
 
 type Block struct {
-	Clock       uint64
-	Parent      crypto.Hash
-	CheckPoint  uint64
-	Publisher   crypto.Token
-	PublishedAt time.Time
-	Events      Events
-	Hash        crypto.Hash
-	Signature   crypto.Signature
+	Clock       uint64           `json:"clock"`
+	Parent      crypto.Hash      `json:"parent"`
+	CheckPoint  uint64           `json:"checkpoint"`
+	Publisher   crypto.Token     `json:"publisher"`
+	Proof       crypto.VRFProof  `json:"proof"` // VRF proof of election, if the engine uses one
+	PublishedAt time.Time        `json:"publishedAt"`
+	EventsRoot  crypto.Hash      `json:"eventsRoot"`
+	Signature   crypto.Signature `json:"signature"`
+	Events      Events           `json:"events"`
 }
 
+// blockJSON has the fields of Block but the publication time, which must be
+// encoded preserving the location the signed bytes were produced with.
+type blockJSON Block
+
+// MarshalJSON encodes every field of the block, events in base64. A decoded
+// block serializes to the same bytes as the original.
+func (b *Block) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		*blockJSON
+		PublishedAt string `json:"publishedAt"`
+	}{blockJSON: (*blockJSON)(b), PublishedAt: formatTime(b.PublishedAt)})
+}
+
+func (b *Block) UnmarshalJSON(data []byte) error {
+	decoded := struct {
+		*blockJSON
+		PublishedAt string `json:"publishedAt"`
+	}{blockJSON: (*blockJSON)(b)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	published, err := time.Parse(time.RFC3339Nano, decoded.PublishedAt)
+	if err != nil {
+		return err
+	}
+	b.PublishedAt = published
+	return nil
+}
+
+// formatTime formats t as RFC3339 with nanoseconds. UTC is written as Z and a
+// zero offset on any other location as +00:00, since the binary encoding of
+// time tells them apart.
+func formatTime(t time.Time) string {
+	if _, offset := t.Zone(); offset == 0 && t.Location() != time.UTC {
+		return t.Format("2006-01-02T15:04:05.999999999") + "+00:00"
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// Sign computes the merkle root of the block events and signs the header.
 func (b *Block) Sign(token crypto.PrivateKey) {
-	b.Signature = token.Sign(b.serializeWithoutSignature())
+	b.EventsRoot = MerkleRoot(b.Events)
+	b.Signature = token.Sign(b.serializeHeader())
+}
+
+// Hash identifies the block. It is the hash of the unsigned header, which
+// commits to the events through their merkle root.
+func (b *Block) Hash() crypto.Hash {
+	return crypto.Hasher(b.serializeHeader())
+}
+
+// Verify checks the signature of the publisher over the header.
+func (b *Block) Verify() bool {
+	return b.Publisher.VerifyZIP215(b.serializeHeader(), b.Signature)
 }
 
+// Serialize encodes the signed header followed by the events, so that the
+// first bytes of a block are also a valid serialization of its header.
 func (b *Block) Serialize() []byte {
-	bytes := b.serializeWithoutSignature()
+	bytes := b.SerializeHeader()
+	util.PutUint16(uint16(len(b.Events)), &bytes)
+	for _, event := range b.Events {
+		util.PutByteArray(event, &bytes)
+	}
+	return bytes
+}
+
+// SerializeHeader encodes the signed header without the events.
+func (b *Block) SerializeHeader() []byte {
+	bytes := b.serializeHeader()
 	util.PutSignature(b.Signature, &bytes)
 	return bytes
 }
 
-func (b *Block) serializeWithoutSignature() []byte {
+func (b *Block) serializeHeader() []byte {
 	bytes := make([]byte, Version)
 	util.PutUint64(b.Clock, &bytes)
-	util.PutByteArray(b.Parent[:], &bytes)
+	util.PutHash(b.Parent, &bytes)
 	util.PutUint64(b.CheckPoint, &bytes)
-	util.PutByteArray(b.Publisher[:], &bytes)
+	util.PutToken(b.Publisher, &bytes)
+	util.PutVRFProof(b.Proof, &bytes)
 	util.PutTime(b.PublishedAt, &bytes)
-	util.PutUint16(uint16(len(b.Events)), &bytes)
-	for _, instruction := range b.Events {
-		util.PutByteArray(instruction, &bytes)
-	}
-	util.PutByteArray(b.Hash[:], &bytes)
+	util.PutHash(b.EventsRoot, &bytes)
 	return bytes
 }
 
-func ParseBlock(data []byte) *Block {
+func parseHeader(data []byte) (*Block, int) {
 	position := 0
 	block := Block{}
 	block.Clock, position = util.ParseUint64(data, position)
 	block.Parent, position = util.ParseHash(data, position)
 	block.CheckPoint, position = util.ParseUint64(data, position)
 	block.Publisher, position = util.ParseToken(data, position)
+	block.Proof, position = util.ParseVRFProof(data, position)
 	block.PublishedAt, position = util.ParseTime(data, position)
-	if position+1 >= len(data) {
+	block.EventsRoot, position = util.ParseHash(data, position)
+	if position+crypto.SignatureSize > len(data) {
+		return nil, position
+	}
+	msg := data[0:position]
+	block.Signature, position = util.ParseSignature(data, position)
+	if position > len(data) || !block.Publisher.VerifyZIP215(msg, block.Signature) {
+		return nil, position
+	}
+	return &block, position
+}
+
+// ParseBlockHeader parses the output of SerializeHeader. The returned block
+// has no events, only their merkle root.
+func ParseBlockHeader(data []byte) *Block {
+	block, position := parseHeader(data)
+	if block == nil || position != len(data) {
+		return nil
+	}
+	return block
+}
+
+func ParseBlock(data []byte) *Block {
+	block, position := parseHeader(data)
+	if block == nil || position+1 >= len(data) {
 		return nil
 	}
 	length := int(data[position+0]) | int(data[position+1])<<8
@@ -64,13 +152,10 @@ func ParseBlock(data []byte) *Block {
 		newEvent, position = util.ParseByteArray(data, position)
 		block.Events[n] = Event(newEvent)
 	}
-	block.Hash, position = util.ParseHash(data, position)
-	msg := data[0:position]
-	block.Signature, _ = util.ParseSignature(data, position)
-	if !block.Publisher.Verify(msg, block.Signature) {
+	if position != len(data) || MerkleRoot(block.Events) != block.EventsRoot {
 		return nil
 	}
-	return &block
+	return block
 }
 
 func GetBlockEpoch(data []byte) uint64 {
@@ -89,24 +174,130 @@ func (b *Block) JSONSimple() string {
 	bulk.PutHex("publisher", b.Publisher[:])
 	bulk.PutTime("publishedAt", b.PublishedAt)
 	bulk.PutUint64("instructionsCount", uint64(len(b.Events)))
-	bulk.PutHex("hash", b.Parent[:])
+	hash := b.Hash()
+	bulk.PutHex("hash", hash[:])
 	bulk.PutBase64("signature", b.Signature[:])
 	return bulk.ToString()
 }
 
 type Signature struct {
-	Hash      crypto.Hash
-	Token     crypto.Token
-	Signature crypto.Signature
+	Hash      crypto.Hash      `json:"hash"`
+	Token     crypto.Token     `json:"token"`
+	Signature crypto.Signature `json:"signature"`
 }
 
+func (s *Signature) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutHash(s.Hash, &bytes)
+	util.PutToken(s.Token, &bytes)
+	util.PutSignature(s.Signature, &bytes)
+	return bytes
+}
+
+func ParseSignature(data []byte) *Signature {
+	if len(data) != crypto.Size+crypto.TokenSize+crypto.SignatureSize {
+		return nil
+	}
+	position := 0
+	signature := Signature{}
+	signature.Hash, position = util.ParseHash(data, position)
+	signature.Token, position = util.ParseToken(data, position)
+	signature.Signature, _ = util.ParseSignature(data, position)
+	return &signature
+}
+
+// SignedBlock is a block with the signatures of its validators. Round is the
+// round of the consensus whose commits sign the block, 0 for engines without
+// rounds, and the signatures are of CommitHash(block hash, Round).
 type SignedBlock struct {
-	Block      *Block
-	Signatures []Signature
+	Block      *Block      `json:"block"`
+	Round      uint32      `json:"round"`
+	Signatures []Signature `json:"signatures"`
+}
+
+// CommitHash returns the hash signed by the validators of the block.
+func (s *SignedBlock) CommitHash() crypto.Hash {
+	return CommitHash(s.Block.Hash(), s.Round)
+}
+
+// Serialize encodes the block bytes prefixed by a uint32 length, since a
+// block can be larger than a byte array, followed by the round and the
+// validator signatures.
+func (s *SignedBlock) Serialize() []byte {
+	bytes := make([]byte, 0)
+	blockBytes := s.Block.Serialize()
+	util.PutUint32(uint32(len(blockBytes)), &bytes)
+	bytes = append(bytes, blockBytes...)
+	util.PutUint32(s.Round, &bytes)
+	util.PutUint16(uint16(len(s.Signatures)), &bytes)
+	for _, signature := range s.Signatures {
+		bytes = append(bytes, signature.Serialize()...)
+	}
+	return bytes
+}
+
+func ParseSignedBlock(data []byte) *SignedBlock {
+	length, position := util.ParseUint32(data, 0)
+	if position+int(length) > len(data) {
+		return nil
+	}
+	block := ParseBlock(data[position : position+int(length)])
+	if block == nil {
+		return nil
+	}
+	position += int(length)
+	round, position := util.ParseUint32(data, position)
+	count, position := util.ParseUint16(data, position)
+	size := crypto.Size + crypto.TokenSize + crypto.SignatureSize
+	if position+int(count)*size != len(data) {
+		return nil
+	}
+	signed := SignedBlock{Block: block, Round: round, Signatures: make([]Signature, count)}
+	for n := 0; n < int(count); n++ {
+		signed.Signatures[n] = *ParseSignature(data[position : position+size])
+		position += size
+	}
+	return &signed
 }
 
 type SignedBlocks []*SignedBlock
 
+func (blocks SignedBlocks) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint32(uint32(len(blocks)), &bytes)
+	for _, block := range blocks {
+		data := block.Serialize()
+		util.PutUint32(uint32(len(data)), &bytes)
+		bytes = append(bytes, data...)
+	}
+	return bytes
+}
+
+func ParseSignedBlocks(data []byte) SignedBlocks {
+	count, position := util.ParseUint32(data, 0)
+	if position > len(data) {
+		return nil
+	}
+	blocks := make(SignedBlocks, 0)
+	for n := 0; n < int(count); n++ {
+		var length uint32
+		length, position = util.ParseUint32(data, position)
+		if position+int(length) > len(data) {
+			return nil
+		}
+		block := ParseSignedBlock(data[position : position+int(length)])
+		if block == nil {
+			return nil
+		}
+		blocks = append(blocks, block)
+		position += int(length)
+	}
+	if position != len(data) {
+		return nil
+	}
+	return blocks
+}
+
 func (blocks SignedBlocks) Less(i, j int) bool {
 	return blocks[i].Block.Clock < blocks[j].Block.Clock
 }
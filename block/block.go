@@ -87,7 +87,7 @@ func ParseBlock(data []byte) *Block {
 	block.FeesCollected, position = util.ParseUint64(data, position)
 	msg := data[0:position]
 	block.Signature, _ = util.ParseSignature(data, position)
-	if !block.Publisher.Verify(msg, block.Signature) {
+	if !block.Publisher.VerifyZIP215(msg, block.Signature) {
 		fmt.Println("wrong signature")
 		return nil
 	}
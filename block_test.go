@@ -0,0 +1,56 @@
+package swell
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+func TestBlockJSON(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	times := []time.Time{
+		time.Unix(1700000000, 123456789),
+		time.Unix(1700000000, 0).UTC(),
+		time.Unix(1700000000, 5).In(time.FixedZone("", 0)),
+		time.Unix(1700000000, 5).In(time.FixedZone("", -3*3600)),
+	}
+	for _, published := range times {
+		block := &Block{
+			Clock:       12,
+			Parent:      crypto.Hasher([]byte("parent")),
+			CheckPoint:  11,
+			Publisher:   token,
+			PublishedAt: published,
+			Events:      Events{newEvent(12, 1), newEvent(12, 2)},
+		}
+		block.Sign(key)
+		signed := &SignedBlock{Block: block, Signatures: []Signature{{Hash: block.Hash(), Token: token, Signature: key.Sign([]byte("x"))}}}
+		data, err := json.Marshal(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded SignedBlock
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.Serialize(), signed.Serialize()) {
+			t.Errorf("decoded block does not serialize to the same bytes for %v: %s", published, data)
+		}
+		if ParseBlock(decoded.Block.Serialize()) == nil {
+			t.Error("decoded block signature not valid")
+		}
+	}
+	block := &Block{Clock: 1, Parent: crypto.Hasher([]byte("parent"))}
+	var summary map[string]any
+	if err := json.Unmarshal([]byte(block.JSONSimple()), &summary); err != nil {
+		t.Fatal(err)
+	}
+	hash := block.Hash()
+	if summary["hash"] != "0x"+hex.EncodeToString(hash[:]) {
+		t.Errorf("wrong summary hash: %v", summary["hash"])
+	}
+}
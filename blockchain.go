@@ -1,14 +1,261 @@
 package swell
 
 import (
+	"fmt"
+	"sort"
 	"time"
+
+	"github.com/lienkolabs/swell/crypto"
 )
 
+type Validator struct {
+	Token crypto.Token `json:"token"`
+	Stake uint64       `json:"stake"`
+}
+
 type BlockChain struct {
+	ChainID         string
+	GenesisHash     crypto.Hash
 	GenesisTime     time.Time
+	SlotDuration    time.Duration // DefaultSlotDuration if zero
+	EpochSlots      uint64        // DefaultEpochSlots if zero
+	Params          ConsensusParams
 	TotalStake      uint64
 	Epoch           uint64
+	Validators      []Validator // validators of the next clock
+	Registry        *ValidatorRegistry
 	CurrentState    State
 	RecentBlocks    SignedBlocks
 	CandidateBlocks map[uint64]SignedBlocks
+	Time            TimeSource // the system clock if nil
+}
+
+// TimeSource returns the source of time of the engine running the chain.
+func (b *BlockChain) TimeSource() TimeSource {
+	if b.Time == nil {
+		return SystemTime
+	}
+	return b.Time
+}
+
+// Calendar returns the calendar of the slots and epochs of the chain.
+func (b *BlockChain) Calendar() Calendar {
+	return NewCalendar(b.GenesisTime, b.SlotDuration, b.EpochSlots)
+}
+
+// ValidatorSet returns the validators that sign the block of clock. Without a
+// registry it is always the current validator set.
+func (b *BlockChain) ValidatorSet(clock uint64) *ValidatorSet {
+	if b.Registry != nil {
+		return b.Registry.At(clock)
+	}
+	return &ValidatorSet{Validators: b.Validators, TotalStake: b.TotalStake}
+}
+
+// SetChange returns the set change signed by key if the block of clock
+// changed the validator set and key is a validator of the set it replaces,
+// nil otherwise.
+func (b *BlockChain) SetChange(clock uint64, key crypto.PrivateKey) *SetChange {
+	if b.Registry == nil {
+		return nil
+	}
+	current, next := b.Registry.At(clock), b.Registry.At(clock+1)
+	if next == current || current.Stake(key.PublicKey()) == 0 {
+		return nil
+	}
+	hash := next.Hash()
+	return &SetChange{Set: next, Signature: Signature{Hash: hash, Token: key.PublicKey(), Signature: key.Sign(hash[:])}}
+}
+
+// Stake returns the stake of token within the current validator set.
+func (b *BlockChain) Stake(token crypto.Token) uint64 {
+	return (&ValidatorSet{Validators: b.Validators}).Stake(token)
+}
+
+// IsValidator checks if hash is the hash of the token of a validator.
+func (b *BlockChain) IsValidator(hash crypto.Hash) bool {
+	for _, validator := range b.Validators {
+		if crypto.HashToken(validator.Token) == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// HasQuorum checks if the signatures are from current validators holding
+// more than two thirds of the total stake.
+func (b *BlockChain) HasQuorum(signatures []Signature) bool {
+	return (&ValidatorSet{Validators: b.Validators, TotalStake: b.TotalStake}).HasQuorum(signatures)
+}
+
+// VerifyQuorum checks that the signatures of signed are valid signatures of
+// its commit hash by distinct validators holding more than two thirds of the
+// stake of the validator set of the block clock.
+func (b *BlockChain) VerifyQuorum(signed *SignedBlock) bool {
+	return b.ValidatorSet(signed.Block.Clock).QuorumSigned(signed.CommitHash(), signed.Signatures)
+}
+
+// Tip returns the hash and clock of the last finalized block. Before any
+// block is finalized it is the genesis hash.
+func (b *BlockChain) Tip() (crypto.Hash, uint64) {
+	if len(b.RecentBlocks) == 0 {
+		return b.GenesisHash, b.Epoch
+	}
+	last := b.RecentBlocks[len(b.RecentBlocks)-1].Block
+	return last.Hash(), last.Clock
+}
+
+// Finalized returns the recent finalized block of clock, or nil if there is
+// none.
+func (b *BlockChain) Finalized(clock uint64) *SignedBlock {
+	n := sort.Search(len(b.RecentBlocks), func(i int) bool { return b.RecentBlocks[i].Block.Clock >= clock })
+	if n < len(b.RecentBlocks) && b.RecentBlocks[n].Block.Clock == clock {
+		return b.RecentBlocks[n]
+	}
+	return nil
+}
+
+// VerifyEvidence checks that evidence proves an equivocation by a validator
+// of the set of its clock, within EvidenceWindow clocks of the tip, so that
+// peers cannot have a node penalize keys without stake or replay evidence
+// the engine no longer deduplicates.
+func (b *BlockChain) VerifyEvidence(evidence *Evidence) bool {
+	_, tip := b.Tip()
+	if evidence.Clock+EvidenceWindow < tip || evidence.Clock > tip+EvidenceWindow {
+		return false
+	}
+	return b.ValidatorSet(evidence.Clock).Stake(evidence.Offender) > 0 && evidence.Verify()
+}
+
+// SeedAnchor returns the hash of the last block finalized before the epoch
+// preceding epoch, crypto.ZeroHash for the first two epochs. Engines electing
+// leaders by epoch mix it into the seed of epoch, which every node then
+// derives from the finalized chain a whole epoch before it is used. Until a
+// block is finalized past the boundary the anchor is the tip, which holds as
+// long as blocks are finalized within an epoch of their slot. It is false if
+// the chain does not hold the block, pruned or older than the snapshot the
+// chain was restored from.
+func (b *BlockChain) SeedAnchor(epoch uint64) (crypto.Hash, bool) {
+	if epoch < 2 {
+		return crypto.ZeroHash, true
+	}
+	boundary := b.Calendar().FirstClock(epoch - 1)
+	n := sort.Search(len(b.RecentBlocks), func(i int) bool { return b.RecentBlocks[i].Block.Clock >= boundary })
+	if n == len(b.RecentBlocks) {
+		hash, clock := b.Tip()
+		return hash, clock < boundary
+	}
+	// the first block past the boundary extends the anchor
+	if block := b.RecentBlocks[n].Block; block.CheckPoint < boundary {
+		return block.Parent, true
+	}
+	return crypto.ZeroHash, false
+}
+
+// SeedBlocks returns the recent finalized blocks older than clock that fix
+// the seed anchors of the epoch of clock and of the next one, so that a chain
+// restored from a snapshot at clock knows them.
+func (b *BlockChain) SeedBlocks(clock uint64) SignedBlocks {
+	calendar := b.Calendar()
+	blocks := make(SignedBlocks, 0)
+	for _, epoch := range []uint64{calendar.Epoch(clock), calendar.Epoch(clock) + 1} {
+		if epoch < 2 {
+			continue
+		}
+		boundary := calendar.FirstClock(epoch - 1)
+		n := sort.Search(len(b.RecentBlocks), func(i int) bool { return b.RecentBlocks[i].Block.Clock >= boundary })
+		if n == len(b.RecentBlocks) || b.RecentBlocks[n].Block.Clock >= clock {
+			continue
+		}
+		if len(blocks) == 0 || blocks[len(blocks)-1] != b.RecentBlocks[n] {
+			blocks = append(blocks, b.RecentBlocks[n])
+		}
+	}
+	return blocks
+}
+
+// prune forgets the recent blocks before the first one at or after the start
+// of the epoch before the epoch of the tip.
+func (b *BlockChain) prune() {
+	calendar := b.Calendar()
+	epoch := calendar.Epoch(b.Epoch)
+	if epoch < 2 {
+		return
+	}
+	boundary := calendar.FirstClock(epoch - 1)
+	n := sort.Search(len(b.RecentBlocks), func(i int) bool { return b.RecentBlocks[i].Block.Clock >= boundary })
+	if n > 0 && n < len(b.RecentBlocks) {
+		b.RecentBlocks = append(make(SignedBlocks, 0, len(b.RecentBlocks)-n), b.RecentBlocks[n:]...)
+	}
+}
+
+// Candidate returns the candidate block with the given hash.
+func (b *BlockChain) Candidate(clock uint64, hash crypto.Hash) *SignedBlock {
+	for _, candidate := range b.CandidateBlocks[clock] {
+		if candidate.Block.Hash() == hash {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// AppendCandidate includes block among the candidates for its clock. If the
+// block is already a candidate the existing one is returned.
+func (b *BlockChain) AppendCandidate(block *Block) *SignedBlock {
+	if existing := b.Candidate(block.Clock, block.Hash()); existing != nil {
+		return existing
+	}
+	signed := &SignedBlock{Block: block, Signatures: make([]Signature, 0)}
+	b.CandidateBlocks[block.Clock] = append(b.CandidateBlocks[block.Clock], signed)
+	return signed
+}
+
+// AppendSignature includes a validator signature to the candidate block it
+// refers to. It returns the candidate if the signature is new and valid.
+func (b *BlockChain) AppendSignature(clock uint64, signature Signature) *SignedBlock {
+	candidate := b.Candidate(clock, signature.Hash)
+	if candidate == nil || b.Stake(signature.Token) == 0 {
+		return nil
+	}
+	for _, existing := range candidate.Signatures {
+		if existing.Token == signature.Token {
+			return nil
+		}
+	}
+	if !signature.Token.VerifyZIP215(signature.Hash[:], signature.Signature) {
+		return nil
+	}
+	candidate.Signatures = append(candidate.Signatures, signature)
+	return candidate
+}
+
+// Commit commits overlay, holding the events of signed applied on top of
+// the tip, into the state and finalizes signed. An error means that the state
+// cannot incorporate a block finalized by the validators: the node diverged
+// and its engine must stop.
+func (b *BlockChain) Commit(signed *SignedBlock, overlay Overlay) error {
+	if err := b.CurrentState.Commit(overlay); err != nil {
+		return fmt.Errorf("could not commit block %v: %w", signed.Block.Clock, err)
+	}
+	b.Finalize(signed)
+	return nil
+}
+
+// Finalize moves a candidate into the recent blocks and discards every
+// competing candidate for the same clock. Blocks must be finalized in clock
+// order. Recent blocks are kept from the first one of the epoch before the
+// epoch of the tip, as needed by SeedAnchor. With a registry the validators
+// are updated to the set of the following clock.
+func (b *BlockChain) Finalize(signed *SignedBlock) {
+	clock := signed.Block.Clock
+	delete(b.CandidateBlocks, clock)
+	b.RecentBlocks = append(b.RecentBlocks, signed)
+	if clock > b.Epoch {
+		b.Epoch = clock
+	}
+	b.prune()
+	if b.Registry != nil {
+		set := b.Registry.At(b.Epoch + 1)
+		b.Validators, b.TotalStake = set.Validators, set.TotalStake
+	}
 }
@@ -0,0 +1,50 @@
+package swell
+
+import (
+	"time"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// BlockBuild fills the block prepared by BlockBuilder and returns it unsigned.
+// It must be called from the goroutine of the engine, which owns the pool and
+// the state.
+type BlockBuild func() *Block
+
+// BlockBuilder prepares a new block for clock. At finish, as given by source,
+// the returned channel hands the engine the BlockBuild that fills the block
+// with events taken from pool in the order given by the pool ordering policy
+// until the pool is empty, the block reaches MaxBlockEvents or the next event
+// does not fit in the remaining block bytes, in which case it stays in the
+// pool at its position. Every event is applied to overlay, which must have
+// been created for clock. Events larger than MaxEventSize or rejected by the
+// overlay are dropped. The caller must receive from the channel.
+func BlockBuilder(parent crypto.Hash, checkpoint, clock uint64, token crypto.Token, finish time.Time, pool *EventsPool, overlay Overlay, params ConsensusParams, source TimeSource) chan BlockBuild {
+	ready := make(chan BlockBuild)
+	params = params.WithDefaults()
+	block := &Block{
+		Clock:      clock,
+		Parent:     parent,
+		CheckPoint: checkpoint,
+		Publisher:  token,
+		Events:     make(Events, 0),
+	}
+	build := func() *Block {
+		size := block.Size()
+		for len(block.Events) < params.MaxBlockEvents {
+			event, _ := pool.Peek()
+			if event == nil || len(event) <= params.MaxEventSize && size+2+len(event) > params.MaxBlockBytes {
+				break
+			}
+			pool.Unqueue()
+			if len(event) <= params.MaxEventSize && overlay.Apply(event) {
+				block.Events = append(block.Events, event)
+				size += 2 + len(event)
+			}
+		}
+		block.PublishedAt = source.Now()
+		return block
+	}
+	source.AfterFunc(finish.Sub(source.Now()), func() { ready <- build })
+	return ready
+}
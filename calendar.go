@@ -0,0 +1,76 @@
+package swell
+
+import "time"
+
+const (
+	DefaultSlotDuration = time.Second
+	DefaultEpochSlots   = 100
+)
+
+// Calendar divides the time after genesis into slots of equal duration and
+// the slots into epochs of EpochSlots slots. The block of clock c is due
+// within the slot from Start(c) to End(c). Clock 0 is the genesis itself, so
+// that the first slot after genesis is the slot of clock 1.
+type Calendar struct {
+	Genesis      time.Time
+	SlotDuration time.Duration
+	EpochSlots   uint64
+}
+
+// NewCalendar returns the calendar of a chain starting at genesis. Zero slot
+// duration or epoch length are replaced by the defaults.
+func NewCalendar(genesis time.Time, slot time.Duration, epochSlots uint64) Calendar {
+	if slot <= 0 {
+		slot = DefaultSlotDuration
+	}
+	if epochSlots == 0 {
+		epochSlots = DefaultEpochSlots
+	}
+	return Calendar{Genesis: genesis, SlotDuration: slot, EpochSlots: epochSlots}
+}
+
+// Start returns the beginning of the slot of clock.
+func (c Calendar) Start(clock uint64) time.Time {
+	if clock == 0 {
+		return c.Genesis
+	}
+	return c.End(clock - 1)
+}
+
+// End returns the end of the slot of clock.
+func (c Calendar) End(clock uint64) time.Time {
+	return c.Genesis.Add(time.Duration(clock) * c.SlotDuration)
+}
+
+// Until returns the time left from now to the end of the slot of clock.
+func (c Calendar) Until(clock uint64, now time.Time) time.Duration {
+	return c.End(clock).Sub(now)
+}
+
+// ClockAt returns the clock whose slot contains t, 0 before genesis.
+func (c Calendar) ClockAt(t time.Time) uint64 {
+	if t.Before(c.Genesis) {
+		return 0
+	}
+	return uint64(t.Sub(c.Genesis)/c.SlotDuration) + 1
+}
+
+// Epoch returns the epoch of clock.
+func (c Calendar) Epoch(clock uint64) uint64 {
+	return clock / c.EpochSlots
+}
+
+// Slot returns the position of clock within its epoch.
+func (c Calendar) Slot(clock uint64) uint64 {
+	return clock % c.EpochSlots
+}
+
+// FirstClock returns the first clock of epoch.
+func (c Calendar) FirstClock(epoch uint64) uint64 {
+	return epoch * c.EpochSlots
+}
+
+// EpochAt returns the epoch of the slot containing t.
+func (c Calendar) EpochAt(t time.Time) uint64 {
+	return c.Epoch(c.ClockAt(t))
+}
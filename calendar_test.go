@@ -0,0 +1,38 @@
+package swell
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendar(t *testing.T) {
+	genesis := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	calendar := (&Genesis{GenesisTime: genesis, SlotMilliseconds: 250, EpochSlots: 100}).Calendar()
+	if calendar.SlotDuration != 250*time.Millisecond || calendar.EpochSlots != 100 {
+		t.Fatal("calendar does not follow the genesis")
+	}
+	if calendar.ClockAt(genesis.Add(-time.Second)) != 0 || calendar.ClockAt(genesis) != 1 {
+		t.Fatal("wrong first clock")
+	}
+	for clock := uint64(1); clock < 1000; clock += 37 {
+		start, end := calendar.Start(clock), calendar.End(clock)
+		if end.Sub(start) != 250*time.Millisecond {
+			t.Fatal("wrong slot duration")
+		}
+		if calendar.ClockAt(start) != clock || calendar.ClockAt(end.Add(-time.Nanosecond)) != clock || calendar.ClockAt(end) != clock+1 {
+			t.Fatalf("slot of clock %v does not contain it", clock)
+		}
+		if calendar.Until(clock, start) != 250*time.Millisecond {
+			t.Fatal("wrong time to the end of the slot")
+		}
+	}
+	if calendar.Epoch(99) != 0 || calendar.Epoch(100) != 1 || calendar.Slot(250) != 50 || calendar.FirstClock(3) != 300 {
+		t.Fatal("wrong epochs")
+	}
+	if calendar.EpochAt(genesis.Add(25*time.Second)) != 1 {
+		t.Fatal("wrong epoch at 25s")
+	}
+	if defaults := (&BlockChain{GenesisTime: genesis}).Calendar(); defaults.SlotDuration != DefaultSlotDuration || defaults.EpochSlots != DefaultEpochSlots {
+		t.Fatal("chain calendar without defaults")
+	}
+}
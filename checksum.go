@@ -0,0 +1,190 @@
+package swell
+
+import (
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/util"
+)
+
+// StateChecksum is the checksum of the committed state at Clock signed by a
+// validator. Validators publish one at the first block finalized in every
+// epoch of the calendar so that nodes whose state diverged from the rest find
+// out.
+type StateChecksum struct {
+	Clock     uint64
+	Hash      crypto.Hash
+	Token     crypto.Token
+	Signature crypto.Signature
+}
+
+const stateChecksumSize = 8 + crypto.Size + crypto.TokenSize + crypto.SignatureSize
+
+func NewStateChecksum(clock uint64, hash crypto.Hash, key crypto.PrivateKey) *StateChecksum {
+	checksum := &StateChecksum{Clock: clock, Hash: hash, Token: key.PublicKey()}
+	checksum.Signature = key.Sign(checksum.serializeToSign())
+	return checksum
+}
+
+func (c *StateChecksum) serializeToSign() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(c.Clock, &bytes)
+	util.PutHash(c.Hash, &bytes)
+	util.PutToken(c.Token, &bytes)
+	return bytes
+}
+
+func (c *StateChecksum) Serialize() []byte {
+	bytes := c.serializeToSign()
+	util.PutSignature(c.Signature, &bytes)
+	return bytes
+}
+
+func (c *StateChecksum) Verify() bool {
+	return c.Token.VerifyZIP215(c.serializeToSign(), c.Signature)
+}
+
+// ParseStateChecksum parses a checksum and verifies its signature.
+func ParseStateChecksum(data []byte) *StateChecksum {
+	if len(data) != stateChecksumSize {
+		return nil
+	}
+	checksum := StateChecksum{}
+	position := 0
+	checksum.Clock, position = util.ParseUint64(data, position)
+	checksum.Hash, position = util.ParseHash(data, position)
+	checksum.Token, position = util.ParseToken(data, position)
+	checksum.Signature, _ = util.ParseSignature(data, position)
+	if !checksum.Verify() {
+		return nil
+	}
+	return &checksum
+}
+
+// ChecksumDenunciation is raised by a node whose own checksum for Clock
+// differs from the one signed by validators holding more than two thirds of
+// the stake. Majority holds their signed checksums.
+type ChecksumDenunciation struct {
+	Clock    uint64
+	Own      crypto.Hash
+	Majority []*StateChecksum
+}
+
+func (d *ChecksumDenunciation) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(d.Clock, &bytes)
+	util.PutHash(d.Own, &bytes)
+	util.PutUint16(uint16(len(d.Majority)), &bytes)
+	for _, checksum := range d.Majority {
+		bytes = append(bytes, checksum.Serialize()...)
+	}
+	return bytes
+}
+
+func ParseChecksumDenunciation(data []byte) *ChecksumDenunciation {
+	denunciation := ChecksumDenunciation{}
+	position := 0
+	denunciation.Clock, position = util.ParseUint64(data, position)
+	denunciation.Own, position = util.ParseHash(data, position)
+	var count uint16
+	count, position = util.ParseUint16(data, position)
+	if position+int(count)*stateChecksumSize != len(data) {
+		return nil
+	}
+	denunciation.Majority = make([]*StateChecksum, count)
+	for n := range denunciation.Majority {
+		if denunciation.Majority[n] = ParseStateChecksum(data[position : position+stateChecksumSize]); denunciation.Majority[n] == nil {
+			return nil
+		}
+		position += stateChecksumSize
+	}
+	return &denunciation
+}
+
+// Verify checks that the majority checksums are for the same clock and hash,
+// different from Own, and signed by distinct validators of set holding more
+// than two thirds of the stake.
+func (d *ChecksumDenunciation) Verify(set *ValidatorSet) bool {
+	if len(d.Majority) == 0 || d.Majority[0].Hash == d.Own {
+		return false
+	}
+	signers := make(map[crypto.Token]struct{})
+	stake := uint64(0)
+	for _, checksum := range d.Majority {
+		if checksum.Clock != d.Clock || checksum.Hash != d.Majority[0].Hash || !checksum.Verify() {
+			return false
+		}
+		if _, ok := signers[checksum.Token]; !ok {
+			signers[checksum.Token] = struct{}{}
+			stake += set.Stake(checksum.Token)
+		}
+	}
+	return 3*stake > 2*set.TotalStake
+}
+
+// ChecksumAggregator collects the checksums signed by validators for a
+// clock and tells whether the checksum of the node agrees with the stake
+// majority.
+type ChecksumAggregator struct {
+	clock     uint64
+	set       *ValidatorSet
+	votes     map[crypto.Token]*StateChecksum
+	stakes    map[crypto.Hash]uint64
+	own       *crypto.Hash
+	denounced bool
+}
+
+func NewChecksumAggregator(clock uint64, set *ValidatorSet) *ChecksumAggregator {
+	return &ChecksumAggregator{
+		clock:  clock,
+		set:    set,
+		votes:  make(map[crypto.Token]*StateChecksum),
+		stakes: make(map[crypto.Hash]uint64),
+	}
+}
+
+// Add records checksum if it is a valid checksum for the clock by a validator
+// that has not voted yet.
+func (a *ChecksumAggregator) Add(checksum *StateChecksum) bool {
+	if checksum == nil || checksum.Clock != a.clock {
+		return false
+	}
+	stake := a.set.Stake(checksum.Token)
+	if _, voted := a.votes[checksum.Token]; voted || stake == 0 || !checksum.Verify() {
+		return false
+	}
+	a.votes[checksum.Token] = checksum
+	a.stakes[checksum.Hash] += stake
+	return true
+}
+
+// SetOwn records the checksum computed by the node itself.
+func (a *ChecksumAggregator) SetOwn(hash crypto.Hash) {
+	a.own = &hash
+}
+
+// Majority returns the checksum signed by more than two thirds of the stake,
+// if any.
+func (a *ChecksumAggregator) Majority() (crypto.Hash, bool) {
+	for hash, stake := range a.stakes {
+		if 3*stake > 2*a.set.TotalStake {
+			return hash, true
+		}
+	}
+	return crypto.Hash{}, false
+}
+
+// Divergence returns a denunciation the first time it is called after the
+// node checksum and a different majority checksum are both known.
+func (a *ChecksumAggregator) Divergence() *ChecksumDenunciation {
+	majority, ok := a.Majority()
+	if a.denounced || !ok || a.own == nil || *a.own == majority {
+		return nil
+	}
+	a.denounced = true
+	denunciation := &ChecksumDenunciation{Clock: a.clock, Own: *a.own, Majority: make([]*StateChecksum, 0)}
+	for _, checksum := range a.votes {
+		if checksum.Hash == majority {
+			denunciation.Majority = append(denunciation.Majority, checksum)
+		}
+	}
+	return denunciation
+}
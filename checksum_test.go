@@ -0,0 +1,54 @@
+package swell
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+func TestChecksumAggregator(t *testing.T) {
+	validators := make([]Validator, 4)
+	keys := make([]crypto.PrivateKey, 4)
+	for n := range validators {
+		validators[n].Token, keys[n] = crypto.RandomAsymetricKey()
+		validators[n].Stake = 10
+	}
+	set := NewValidatorSet(0, validators)
+	good, bad := crypto.Hasher([]byte("good")), crypto.Hasher([]byte("bad"))
+	aggregator := NewChecksumAggregator(100, set)
+	aggregator.SetOwn(bad)
+	if !aggregator.Add(NewStateChecksum(100, bad, keys[0])) || aggregator.Add(NewStateChecksum(100, good, keys[0])) {
+		t.Fatal("wrong handling of repeated vote")
+	}
+	if aggregator.Add(NewStateChecksum(99, good, keys[1])) {
+		t.Error("checksum for another clock accepted")
+	}
+	for n := 1; n < 3; n++ {
+		aggregator.Add(ParseStateChecksum(NewStateChecksum(100, good, keys[n]).Serialize()))
+		if aggregator.Divergence() != nil {
+			t.Fatal("divergence raised without a majority")
+		}
+	}
+	aggregator.Add(NewStateChecksum(100, good, keys[3]))
+	denunciation := aggregator.Divergence()
+	if denunciation == nil || aggregator.Divergence() != nil {
+		t.Fatal("divergence not raised exactly once")
+	}
+	parsed := ParseChecksumDenunciation(denunciation.Serialize())
+	if parsed == nil || !parsed.Verify(set) || len(parsed.Majority) != 3 {
+		t.Fatal("invalid denunciation")
+	}
+	parsed.Majority = parsed.Majority[:2]
+	if parsed.Verify(set) {
+		t.Error("denunciation without majority accepted")
+	}
+
+	agreeing := NewChecksumAggregator(100, set)
+	agreeing.SetOwn(good)
+	for n := range keys {
+		agreeing.Add(NewStateChecksum(100, good, keys[n]))
+	}
+	if hash, ok := agreeing.Majority(); !ok || hash != good || agreeing.Divergence() != nil {
+		t.Error("agreeing node raised divergence")
+	}
+}
@@ -1,50 +1,493 @@
+// Package authority implements a proof of authority consensus engine for
+// permissioned networks.
 package authority
 
 import (
-	"fmt"
+	"bytes"
+	"sort"
 	"time"
 
-	"github.com/Aereum/aereum/core/consensus"
-	"github.com/Aereum/aereum/core/crypto"
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
 )
 
-var blockInterval = time.Second
-
-func NewProofOfAtuhority(chain *consensus.BlockChain, token crypto.PrivateKey) *consensus.Communication {
-	comm := consensus.NewCommunication()
-	pool := consensus.NewInstructionPool()
-	go func() {
-		for {
-			select {
-			case peer := <-comm.PeerRequest:
-				peer.Response <- false
-			case <-comm.BlockSignature:
-				// do nothing
-			case <-comm.Checksum:
-				// do nothing
-			case sync := <-comm.Synchronization:
-				sync.Ok <- false
-			case hashedInst := <-comm.Instructions:
-				pool.Queue(hashedInst.Instruction, hashedInst.Hash)
-			case validate := <-comm.ValidateConn:
-				validate.Ok <- true
-			}
-		}
-	}()
-
-	go func() {
-		epoch := chain.Epoch + 1
-		for {
-			fmt.Println(epoch)
-			nextBlock := time.Now().Add(consensus.IntervalToNewEpoch(epoch, chain.GenesisTime))
-			//fmt.Println(nextBlock)
-			newBlock := <-consensus.BlockBuilder(chain.GetLastCheckpoint(), epoch, token, nextBlock, pool)
-			newBlock.Sign(token)
-			chain.CurrentState.IncorporateBlock(newBlock)
-			comm.Checkpoint <- &consensus.SignedBlock{Block: newBlock, Signatures: make([]consensus.Signature, 0)}
-			epoch += 1
-		}
-	}()
-
-	return comm
+// buildFraction is the fraction of the turn timeout the authority spends
+// pulling events from the pool before publishing its block.
+const buildFraction = 2
+
+// maxBackoff bounds the doubling of the turn timeout after consecutive turns
+// without a certified block.
+const maxBackoff = 6
+
+// maxPending is the maximum number of signatures and of blocks whose block
+// or parent is not yet known kept until it arrives or is finalized away.
+const maxPending = 1024
+
+// Engine is a proof of authority engine where a list of authorities take
+// turns by clock: the authority of clock c is the authority c modulo the
+// number of authorities, in token order. At its turn the authority builds a block, signs and
+// publishes it. A block counts only if it is signed by the authority of its
+// clock. The other authorities countersign it and a block signed by more than
+// two thirds of them is certified, which ends the turn. A turn without a
+// certified block ends after the timeout, doubled after every consecutive turn
+// without one, and its clock is skipped.
+//
+// Every node locks on the highest certified block it knows. Authorities build
+// on their lock and countersign, once per clock, only blocks whose parent is
+// their lock. A certified block whose parent is certified at the previous
+// clock finalizes the parent and its ancestors.
+//
+// The authorities start as the validators of the chain and are replaced by
+// Change events included in the blocks. They are kept in the validator
+// registry of the chain, with a stake of one each, so that they are restored
+// with the chain and that the chain verifies the blocks with them.
+//
+// All the state is owned by a single goroutine.
+type Engine struct {
+	chain    *swell.BlockChain
+	key      crypto.PrivateKey
+	token    crypto.Token
+	comm     *swell.Communication
+	pool     *swell.EventsPool
+	timeout  time.Duration
+	time     swell.TimeSource
+	expired  chan uint64 // clocks whose turn timed out
+	sync     *swell.SyncServer
+	clock    uint64 // clock of the current turn
+	failures uint   // consecutive turns without a certified block
+	tip      *node  // last finalized block
+	nodes    map[crypto.Hash]*node
+	lock     *node  // highest certified block
+	signed   uint64 // clock of the last block the node signed
+	pending  map[crypto.Hash]*pendingSignatures
+	orphans  map[crypto.Hash][]*swell.Block // blocks by unknown parent
+	// entries of pending and orphans
+	pendingSize int
+	orphanSize  int
+	built       chan swell.BlockBuild
+	building    *overlay
+	parent      *node // block the block being built extends
+	err         error // error that stopped the engine
+}
+
+// pendingSignatures are the signatures of an unknown block received at the
+// turn of clock.
+type pendingSignatures struct {
+	clock      uint64
+	signatures []swell.Signature
+}
+
+// node is a block known to the engine. The tip node of a chain that did not
+// finalize any block yet has no block.
+type node struct {
+	block       *swell.Block
+	hash        crypto.Hash
+	clock       uint64
+	overlay     *overlay
+	authorities []crypto.Token // authorities of the blocks after this one
+	signatures  []swell.Signature
+	certified   bool
+}
+
+// Authority returns the authority of clock for a block after n.
+func (n *node) Authority(clock uint64) crypto.Token {
+	return n.authorities[clock%uint64(len(n.authorities))]
+}
+
+// overlay applies the Change events of a block and hands every other event to
+// the overlay of the state.
+type overlay struct {
+	swell.Overlay
+	authorities []crypto.Token
+	changed     bool
+}
+
+func (o *overlay) Apply(event swell.Event) bool {
+	if change := ParseChange(event); change != nil {
+		if !change.Verify(o.authorities) {
+			return false
+		}
+		o.authorities, o.changed = sortTokens(change.Authorities), true
+		return true
+	}
+	return o.Overlay.Apply(event)
+}
+
+// NewEngine is a swell.ConsensusEngine with the validators of the chain after
+// its tip as authorities. A chain without a validator registry gets one with
+// its validators. A registry with stakes other than one is normalized to a
+// stake of one per authority after the tip, or the engine halts if it cannot
+// be. Turns time out after a slot of the chain calendar.
+func NewEngine(chain *swell.BlockChain, key crypto.PrivateKey) *swell.Communication {
+	hash, clock := chain.Tip()
+	err := normalize(chain, clock)
+	set := chain.ValidatorSet(clock + 1)
+	chain.Validators, chain.TotalStake = set.Validators, set.TotalStake
+	authorities := make([]crypto.Token, len(set.Validators))
+	for n, validator := range set.Validators {
+		authorities[n] = validator.Token
+	}
+	authorities = sortTokens(authorities)
+	tip := &node{hash: hash, clock: clock, authorities: authorities, certified: true}
+	engine := &Engine{
+		chain:   chain,
+		key:     key,
+		token:   key.PublicKey(),
+		comm:    swell.NewCommunication(),
+		pool:    swell.NewInstructionPool(),
+		timeout: chain.Calendar().SlotDuration,
+		time:    chain.TimeSource(),
+		expired: make(chan uint64),
+		sync:    swell.NewSyncServer(chain),
+		tip:     tip,
+		nodes:   map[crypto.Hash]*node{hash: tip},
+		lock:    tip,
+		signed:  clock,
+		pending: make(map[crypto.Hash]*pendingSignatures),
+		orphans: make(map[crypto.Hash][]*swell.Block),
+	}
+	if engine.err = err; err == nil {
+		engine.enterClock(clock + 1)
+	}
+	go engine.run()
+	return engine.comm
+}
+
+// normalize gives the chain a validator registry where every authority after
+// the block of clock has a stake of one.
+func normalize(chain *swell.BlockChain, clock uint64) error {
+	if chain.Registry == nil {
+		validators := make([]swell.Validator, len(chain.Validators))
+		for n, validator := range chain.Validators {
+			validators[n] = swell.Validator{Token: validator.Token, Stake: 1}
+		}
+		chain.Registry = swell.NewValidatorRegistry(validators, 0)
+		return nil
+	}
+	set := chain.ValidatorSet(clock + 1)
+	validators, normalized := make([]swell.Validator, len(set.Validators)), true
+	for n, validator := range set.Validators {
+		validators[n] = swell.Validator{Token: validator.Token, Stake: 1}
+		normalized = normalized && validator.Stake == 1
+	}
+	if normalized {
+		return nil
+	}
+	return chain.Registry.Replace(clock, validators)
+}
+
+// Authority returns the authority of clock after the last finalized block.
+func (e *Engine) Authority(clock uint64) crypto.Token {
+	return e.tip.Authority(clock)
+}
+
+func (e *Engine) run() {
+	for e.err == nil {
+		select {
+		case clock := <-e.expired:
+			if clock == e.clock {
+				e.failures += 1
+				e.enterClock(clock + 1)
+			}
+		case build := <-e.built:
+			e.built = nil
+			block := build()
+			e.publishBuilt(block)
+		case block := <-e.comm.IncomingBlock:
+			if block != nil {
+				e.addBlock(block)
+			}
+		case signature := <-e.comm.IncomingSignature:
+			if signature != nil {
+				e.addSignature(*signature)
+			}
+		case event := <-e.comm.Events:
+			if change := ParseChange(event); change != nil {
+				if change.Verify(e.tip.authorities) {
+					e.pool.Queue(event, event.Hash())
+				}
+			} else if e.chain.CurrentState.Validate(event) {
+				e.pool.Queue(event, event.Hash())
+			}
+		case peer := <-e.comm.PeerRequest:
+			peer.Response <- e.chain.IsValidator(peer.Token)
+		case validate := <-e.comm.ValidateConn:
+			validate.Ok <- e.chain.IsValidator(validate.Token)
+		case sync := <-e.comm.Synchronization:
+			sync.Response <- e.sync.Serve(sync)
+		}
+	}
+	e.comm.Close()
+	e.comm.Halted <- e.err
+}
+
+// enterClock starts the turn of clock and, if the node is its authority,
+// builds a block on top of the lock.
+func (e *Engine) enterClock(clock uint64) {
+	e.clock = clock
+	backoff := e.failures
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	e.time.AfterFunc(e.timeout<<backoff, func() { e.expired <- clock })
+	if e.built != nil || e.lock.Authority(clock) != e.token {
+		return
+	}
+	var parent swell.Overlay
+	if e.lock.overlay != nil {
+		parent = e.lock.overlay.Overlay
+	}
+	e.parent = e.lock
+	e.building = &overlay{Overlay: e.chain.CurrentState.Overlay(parent, clock), authorities: e.lock.authorities}
+	finish := e.time.Now().Add(e.timeout / buildFraction)
+	e.built = swell.BlockBuilder(e.lock.hash, e.tip.clock, clock, e.token, finish, e.pool, e.building, e.chain.Params, e.time)
+}
+
+// publishBuilt signs and publishes the block built by the node if its turn
+// is not over and its parent is still the lock. Otherwise the block is
+// dropped and its events returned to the pool.
+func (e *Engine) publishBuilt(block *swell.Block) {
+	if e.parent == e.lock && block.Clock == e.clock {
+		block.Sign(e.key)
+		e.comm.NewBlock <- block
+		e.addNode(block, e.parent, e.building)
+		return
+	}
+	e.chain.CurrentState.Rollback(e.building.Overlay)
+	for _, event := range block.Events {
+		e.pool.Queue(event, event.Hash())
+	}
+}
+
+// addBlock checks that block is signed by the authority of its clock and
+// applies its events on top of its parent. Blocks of an authority whose
+// parent is not known wait for it.
+func (e *Engine) addBlock(block *swell.Block) {
+	hash := block.Hash()
+	if _, ok := e.nodes[hash]; ok || block.Clock <= e.tip.clock {
+		return
+	}
+	parent, ok := e.nodes[block.Parent]
+	if !ok {
+		if e.orphanSize < maxPending && isAuthority(e.tip.authorities, block.Publisher) && block.Verify() {
+			e.orphans[block.Parent] = append(e.orphans[block.Parent], block)
+			e.orphanSize += 1
+		}
+		return
+	}
+	if block.Clock <= parent.clock || block.Publisher != parent.Authority(block.Clock) || !block.Verify() {
+		return
+	}
+	if !e.chain.Params.CheckLimits(block) {
+		return
+	}
+	var base swell.Overlay
+	if parent.overlay != nil {
+		base = parent.overlay.Overlay
+	}
+	applied := &overlay{Overlay: e.chain.CurrentState.Overlay(base, block.Clock), authorities: parent.authorities}
+	for _, event := range block.Events {
+		if !applied.Apply(event) {
+			e.chain.CurrentState.Rollback(applied.Overlay)
+			return
+		}
+	}
+	e.addNode(block, parent, applied)
+}
+
+// addNode incorporates a valid block and countersigns it if it is safe.
+func (e *Engine) addNode(block *swell.Block, parent *node, applied *overlay) {
+	hash := block.Hash()
+	current := &node{block: block, hash: hash, clock: block.Clock, overlay: applied, authorities: applied.authorities}
+	e.nodes[hash] = current
+	e.countersign(current)
+	if pending, ok := e.pending[hash]; ok {
+		delete(e.pending, hash)
+		e.pendingSize -= len(pending.signatures)
+		for _, signature := range pending.signatures {
+			e.addSignature(signature)
+		}
+	}
+	orphans := e.orphans[hash]
+	delete(e.orphans, hash)
+	e.orphanSize -= len(orphans)
+	for _, orphan := range orphans {
+		e.addBlock(orphan)
+	}
+}
+
+// countersign signs the block of n if the node is one of its authorities,
+// did not sign a block for the clock of n or later and the parent of n is the
+// lock.
+func (e *Engine) countersign(n *node) {
+	parent, ok := e.nodes[n.block.Parent]
+	if !ok || parent != e.lock || n.clock <= e.signed || !isAuthority(parent.authorities, e.token) {
+		return
+	}
+	e.signed = n.clock
+	signature := swell.Signature{Hash: n.hash, Token: e.token, Signature: e.key.Sign(n.hash[:])}
+	e.comm.BlockSignature <- &signature
+	e.addSignature(signature)
+}
+
+// sorted returns the known blocks by clock and then by hash, so that every
+// node visits them in the same order.
+func (e *Engine) sorted() []*node {
+	nodes := make([]*node, 0, len(e.nodes))
+	for _, n := range e.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].clock < nodes[j].clock || nodes[i].clock == nodes[j].clock && bytes.Compare(nodes[i].hash[:], nodes[j].hash[:]) < 0
+	})
+	return nodes
+}
+
+// descends checks if n is ancestor or descends from ancestor.
+func (e *Engine) descends(n, ancestor *node) bool {
+	for n != nil && n.clock >= ancestor.clock {
+		if n == ancestor {
+			return true
+		}
+		if n.block == nil {
+			return false
+		}
+		n = e.nodes[n.block.Parent]
+	}
+	return false
+}
+
+// addSignature collects a countersignature of an authority of the block.
+// Signatures of authorities for blocks not yet known are kept until the
+// block arrives.
+func (e *Engine) addSignature(signature swell.Signature) {
+	n, ok := e.nodes[signature.Hash]
+	if !ok {
+		if e.pendingSize < maxPending && isAuthority(e.tip.authorities, signature.Token) {
+			pending, ok := e.pending[signature.Hash]
+			if !ok {
+				pending = &pendingSignatures{clock: e.clock}
+				e.pending[signature.Hash] = pending
+			}
+			pending.signatures = append(pending.signatures, signature)
+			e.pendingSize += 1
+		}
+		return
+	}
+	if n == e.tip {
+		return
+	}
+	parent, ok := e.nodes[n.block.Parent]
+	if !ok || !isAuthority(parent.authorities, signature.Token) {
+		return
+	}
+	for _, existing := range n.signatures {
+		if existing.Token == signature.Token {
+			return
+		}
+	}
+	if !signature.Token.VerifyZIP215(signature.Hash[:], signature.Signature) {
+		return
+	}
+	n.signatures = append(n.signatures, signature)
+	if !n.certified && 3*len(n.signatures) > 2*len(parent.authorities) {
+		e.certify(n, parent)
+	}
+}
+
+// certify records that n is certified, locks on it, finalizes its parent if
+// they are of consecutive clocks and moves on to the turn after n.
+func (e *Engine) certify(n, parent *node) {
+	n.certified = true
+	if n.clock <= e.lock.clock {
+		return
+	}
+	e.lock = n
+	e.failures = 0
+	if parent != e.tip && parent.certified && n.clock == parent.clock+1 {
+		if e.finalize(parent); e.err != nil {
+			return
+		}
+	}
+	for _, child := range e.sorted() {
+		if child.block != nil && child.block.Parent == n.hash {
+			e.countersign(child)
+		}
+	}
+	if n.clock >= e.clock {
+		e.enterClock(n.clock + 1)
+	}
+}
+
+// finalize finalizes the block of final and every ancestor not yet final,
+// oldest first, and discards the blocks that do not descend from it. Every
+// block finalized is certified. If a block cannot be committed the engine
+// stops.
+func (e *Engine) finalize(final *node) {
+	path := make([]*node, 0)
+	for current := final; current != e.tip; current = e.nodes[current.block.Parent] {
+		path = append(path, current)
+	}
+	for n := len(path) - 1; n >= 0; n-- {
+		current := path[n]
+		signed := e.chain.AppendCandidate(current.block)
+		signed.Signatures = current.signatures
+		if current.overlay.changed {
+			validators := make([]swell.Validator, len(current.authorities))
+			for n, token := range current.authorities {
+				validators[n] = swell.Validator{Token: token, Stake: 1}
+			}
+			if e.err = e.chain.Registry.Replace(current.clock, validators); e.err != nil {
+				return
+			}
+		}
+		if e.err = e.chain.Commit(signed, current.overlay.Overlay); e.err != nil {
+			return
+		}
+		e.pool.DeleteEvents(current.block.Events)
+		e.comm.Checkpoint <- signed
+		if change := e.chain.SetChange(signed.Block.Clock, e.key); change != nil {
+			e.comm.SetChange <- change
+		}
+	}
+	e.prune(final)
+}
+
+// prune makes final the tip, forgets the blocks before it and rolls back
+// every block that does not descend from it.
+func (e *Engine) prune(final *node) {
+	discarded := make(map[crypto.Hash]*node)
+	for _, known := range e.sorted() {
+		if known.clock <= final.clock && known != final || known.clock > final.clock && !e.descends(known, final) {
+			discarded[known.hash] = known
+		}
+	}
+	for _, known := range e.sorted() {
+		if _, ok := discarded[known.hash]; !ok {
+			continue
+		}
+		if known.clock > final.clock {
+			// rolling back a parent rolls back its descendants
+			if _, ok := discarded[known.block.Parent]; !ok {
+				e.chain.CurrentState.Rollback(known.overlay.Overlay)
+			}
+		}
+		delete(e.nodes, known.hash)
+	}
+	for parent, blocks := range e.orphans {
+		if blocks[0].Clock <= final.clock {
+			delete(e.orphans, parent)
+			e.orphanSize -= len(blocks)
+		}
+	}
+	for hash, pending := range e.pending {
+		if pending.clock <= final.clock {
+			delete(e.pending, hash)
+			e.pendingSize -= len(pending.signatures)
+		}
+	}
+	// the overlay of the tip is committed: blocks on top of it start from the
+	// state
+	final.overlay = nil
+	e.tip = final
 }
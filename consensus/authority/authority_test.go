@@ -0,0 +1,182 @@
+package authority
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/simulation"
+)
+
+func newSimulation(nodes int) *simulation.Simulation {
+	return simulation.New(simulation.Config{
+		Seed:     1,
+		Nodes:    nodes,
+		Stake:    1,
+		Engine:   NewEngine,
+		NewState: simulation.NewState,
+		MinDelay: 5 * time.Millisecond,
+		MaxDelay: 20 * time.Millisecond,
+		Slot:     100 * time.Millisecond,
+	})
+}
+
+// checkAgreement checks that the live nodes finalized the same blocks.
+func checkAgreement(t *testing.T, s *simulation.Simulation, live int) []*swell.SignedBlock {
+	finalized := s.Nodes[0].Finalized
+	for _, node := range s.Nodes[1:live] {
+		for n := 0; n < len(finalized) && n < len(node.Finalized); n++ {
+			if finalized[n].Block.Hash() != node.Finalized[n].Block.Hash() {
+				t.Fatal("authorities diverged")
+			}
+		}
+	}
+	return finalized
+}
+
+// tokens returns the tokens of the first count nodes in token order, the
+// order of the turns.
+func tokens(s *simulation.Simulation, count int) []crypto.Token {
+	tokens := make([]crypto.Token, count)
+	for n := range tokens {
+		tokens[n] = s.Nodes[n].Key.PublicKey()
+	}
+	return sortTokens(tokens)
+}
+
+func TestRoundRobin(t *testing.T) {
+	s := newSimulation(4)
+	authorities, crashed := tokens(s, 4), s.Nodes[3].Key.PublicKey()
+	for n := 0; n < 10; n++ {
+		s.Submit(n%3, simulation.NewEvent(uint64(n+1)))
+	}
+	s.Crash(3)
+	s.Run(3 * time.Second)
+	finalized := checkAgreement(t, s, 3)
+	if len(finalized) < 10 {
+		t.Fatal("authorities did not make progress")
+	}
+	events := 0
+	for _, signed := range finalized {
+		if publisher := signed.Block.Publisher; publisher != authorities[signed.Block.Clock%4] || publisher == crashed {
+			t.Fatalf("block of clock %v not published by its authority", signed.Block.Clock)
+		}
+		events += len(signed.Block.Events)
+	}
+	if events != 10 {
+		t.Fatalf("%v events finalized, expected 10", events)
+	}
+	last := finalized[len(finalized)-1]
+	if 3*len(last.Signatures) <= 2*4 || !swell.NewValidatorSet(0, s.Nodes[0].Chain.Validators).QuorumSigned(last.Block.Hash(), last.Signatures) {
+		t.Fatal("final block without countersignatures of the authorities")
+	}
+}
+
+func TestChangeAuthorities(t *testing.T) {
+	s := newSimulation(4)
+	previous, tokens := tokens(s, 4), tokens(s, 3)
+	removed := s.Nodes[3].Key.PublicKey()
+	weak := NewChange(1, previous, tokens[:2])
+	weak.Sign(s.Nodes[0].Key)
+	weak.Sign(s.Nodes[1].Key)
+	change := NewChange(2, previous, tokens)
+	for _, node := range s.Nodes[:3] {
+		change.Sign(node.Key)
+	}
+	if parsed := ParseChange(change.Event()); parsed == nil || parsed.Hash() != change.Hash() || !parsed.Verify(previous) {
+		t.Fatal("change does not round trip")
+	}
+	if change.Verify(tokens) {
+		t.Fatal("change verified against authorities it does not replace")
+	}
+	if ParseChange(simulation.NewEvent(1)) != nil {
+		t.Fatal("application event taken as a change")
+	}
+	s.Submit(0, weak.Event())
+	s.Submit(0, change.Event())
+	s.Run(time.Second)
+	s.Crash(3)
+	s.Run(2 * time.Second)
+	finalized := checkAgreement(t, s, 3)
+	changed := uint64(0)
+	for _, signed := range finalized {
+		for _, event := range signed.Block.Events {
+			if ParseChange(event) != nil {
+				if ParseChange(event).Hash() != change.Hash() {
+					t.Fatal("change without supermajority included")
+				}
+				changed = signed.Block.Clock
+			}
+		}
+	}
+	if changed == 0 {
+		t.Fatal("change not included")
+	}
+	after := 0
+	for _, signed := range finalized {
+		if clock := signed.Block.Clock; clock > changed {
+			if signed.Block.Publisher != tokens[clock%3] {
+				t.Fatalf("block of clock %v not published by the new authority", clock)
+			}
+			after += 1
+		}
+	}
+	if after < 10 {
+		t.Fatal("new authorities did not make progress without the removed one")
+	}
+	chain := s.Nodes[0].Chain
+	if len(chain.ValidatorSet(changed+1).Validators) != 3 || chain.IsValidator(crypto.HashToken(removed)) {
+		t.Fatal("authorities not kept in the chain")
+	}
+	// an engine started over a copy of the chain follows the new authorities
+	registry := swell.NewValidatorRegistry(nil, 0)
+	if err := registry.Restore(chain.Registry.Serialize()); err != nil {
+		t.Fatal(err)
+	}
+	_, tip := chain.Tip()
+	restarted := &swell.BlockChain{Epoch: tip, Registry: registry, CurrentState: &simulation.State{}}
+	comm := swell.LauchNewGenesisConsensus(NewEngine, restarted, s.Nodes[0].Key)
+	for _, token := range previous {
+		response := make(chan bool)
+		comm.PeerRequest <- &swell.PeerRequest{Token: crypto.HashToken(token), Response: response}
+		if <-response != (token != removed) {
+			t.Fatal("restarted engine does not follow the new authorities")
+		}
+	}
+}
+
+func TestNormalizesStakes(t *testing.T) {
+	keys := make([]crypto.PrivateKey, 3)
+	validators := make([]swell.Validator, len(keys))
+	for n := range keys {
+		_, keys[n] = crypto.RandomAsymetricKey()
+		validators[n] = swell.Validator{Token: keys[n].PublicKey(), Stake: uint64(10 * (n + 1))}
+	}
+	chain := &swell.BlockChain{Registry: swell.NewValidatorRegistry(validators, 0), CurrentState: &simulation.State{}}
+	comm := swell.LauchNewGenesisConsensus(NewEngine, chain, keys[0])
+	response := make(chan bool)
+	comm.PeerRequest <- &swell.PeerRequest{Token: crypto.HashToken(keys[2].PublicKey()), Response: response}
+	if !<-response {
+		t.Fatal("authority not recognized")
+	}
+	set := chain.ValidatorSet(1)
+	for _, validator := range set.Validators {
+		if validator.Stake != 1 {
+			t.Fatal("stake not normalized")
+		}
+	}
+	if len(set.Validators) != 3 || set.TotalStake != 3 || chain.TotalStake != 3 {
+		t.Fatal("authorities not kept")
+	}
+	// a registry that cannot be normalized after the tip halts the engine
+	registry := swell.NewValidatorRegistry(validators, 0)
+	if err := registry.Deposit(5, keys[0].PublicKey(), 1); err != nil {
+		t.Fatal(err)
+	}
+	chain = &swell.BlockChain{Registry: registry, CurrentState: &simulation.State{}}
+	comm = swell.LauchNewGenesisConsensus(NewEngine, chain, keys[0])
+	if err := <-comm.Halted; err != swell.ErrRegistryClock {
+		t.Fatalf("engine started with stakes other than one: %v", err)
+	}
+}
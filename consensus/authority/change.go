@@ -0,0 +1,154 @@
+package authority
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/util"
+)
+
+// changeTag follows the version and clock of an authority change event. The
+// engine takes every event starting with it as a change, so applications
+// must not emit events that do.
+var changeTag = []byte("\x00swell/authorities")
+
+// Change is an event that replaces the list of authorities for the blocks
+// after the block that includes it. It counts only if signed by more than two
+// thirds of the authorities in force for that block and if Previous is the
+// hash of that list, so that it is not replayed against another one.
+type Change struct {
+	Clock       uint64      // clock of the event, as for any event
+	Previous    crypto.Hash // AuthoritiesHash of the authorities replaced
+	Authorities []crypto.Token
+	Signatures  []swell.Signature
+}
+
+func NewChange(clock uint64, previous, authorities []crypto.Token) *Change {
+	return &Change{Clock: clock, Previous: AuthoritiesHash(previous), Authorities: authorities, Signatures: make([]swell.Signature, 0)}
+}
+
+// AuthoritiesHash returns the hash of a list of authorities regardless of
+// its order.
+func AuthoritiesHash(authorities []crypto.Token) crypto.Hash {
+	bytes := make([]byte, 0)
+	for _, token := range sortTokens(authorities) {
+		util.PutToken(token, &bytes)
+	}
+	return crypto.Hasher(bytes)
+}
+
+// sortTokens returns a copy of tokens in increasing order.
+func sortTokens(tokens []crypto.Token) []crypto.Token {
+	sorted := append([]crypto.Token{}, tokens...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i][:], sorted[j][:]) < 0 })
+	return sorted
+}
+
+func (c *Change) serializeToSign() []byte {
+	bytes := []byte{swell.Version}
+	util.PutUint64(c.Clock, &bytes)
+	bytes = append(bytes, changeTag...)
+	util.PutHash(c.Previous, &bytes)
+	util.PutUint16(uint16(len(c.Authorities)), &bytes)
+	for _, token := range c.Authorities {
+		util.PutToken(token, &bytes)
+	}
+	return bytes
+}
+
+// Hash is the hash signed by the authorities.
+func (c *Change) Hash() crypto.Hash {
+	return crypto.Hasher(c.serializeToSign())
+}
+
+// Sign appends the signature of key to the change.
+func (c *Change) Sign(key crypto.PrivateKey) {
+	hash := c.Hash()
+	c.Signatures = append(c.Signatures, swell.Signature{Hash: hash, Token: key.PublicKey(), Signature: key.Sign(hash[:])})
+}
+
+// Event encodes the change as an event.
+func (c *Change) Event() swell.Event {
+	bytes := c.serializeToSign()
+	util.PutUint16(uint16(len(c.Signatures)), &bytes)
+	for _, signature := range c.Signatures {
+		util.PutToken(signature.Token, &bytes)
+		util.PutSignature(signature.Signature, &bytes)
+	}
+	return swell.Event(bytes)
+}
+
+// ParseChange returns the change encoded by event or nil if event is not a
+// well formed change.
+func ParseChange(event swell.Event) *Change {
+	position := 1 + 8 + len(changeTag)
+	if len(event) < position+crypto.Size+2 || event[0] != swell.Version || !bytes.Equal(event[9:position], changeTag) {
+		return nil
+	}
+	change := Change{Clock: event.Clock()}
+	var count uint16
+	change.Previous, position = util.ParseHash(event, position)
+	count, position = util.ParseUint16(event, position)
+	if len(event) < position+int(count)*crypto.TokenSize+2 {
+		return nil
+	}
+	change.Authorities = make([]crypto.Token, count)
+	for n := range change.Authorities {
+		change.Authorities[n], position = util.ParseToken(event, position)
+	}
+	hash := crypto.Hasher(event[:position])
+	count, position = util.ParseUint16(event, position)
+	if len(event) != position+int(count)*(crypto.TokenSize+crypto.SignatureSize) {
+		return nil
+	}
+	change.Signatures = make([]swell.Signature, count)
+	for n := range change.Signatures {
+		change.Signatures[n].Hash = hash
+		change.Signatures[n].Token, position = util.ParseToken(event, position)
+		change.Signatures[n].Signature, position = util.ParseSignature(event, position)
+	}
+	return &change
+}
+
+// Verify checks that the change replaces authorities, that the new list is
+// not empty and has no repeated token and that the change is signed by more
+// than two thirds of authorities.
+func (c *Change) Verify(authorities []crypto.Token) bool {
+	if c.Previous != AuthoritiesHash(authorities) || len(c.Authorities) == 0 || len(c.Authorities) > 1<<16-1 {
+		return false
+	}
+	listed := make(map[crypto.Token]struct{})
+	for _, token := range c.Authorities {
+		if _, ok := listed[token]; ok {
+			return false
+		}
+		listed[token] = struct{}{}
+	}
+	return signers(authorities, c.Hash(), c.Signatures)*3 > 2*len(authorities)
+}
+
+// signers returns the number of distinct authorities with a valid signature
+// of hash among signatures.
+func signers(authorities []crypto.Token, hash crypto.Hash, signatures []swell.Signature) int {
+	signed := make(map[crypto.Token]struct{})
+	for _, signature := range signatures {
+		if _, ok := signed[signature.Token]; ok || signature.Hash != hash || !isAuthority(authorities, signature.Token) {
+			continue
+		}
+		if signature.Token.VerifyZIP215(hash[:], signature.Signature) {
+			signed[signature.Token] = struct{}{}
+		}
+	}
+	return len(signed)
+}
+
+func isAuthority(authorities []crypto.Token, token crypto.Token) bool {
+	for _, authority := range authorities {
+		if authority == token {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/consensus/dev"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+func TestRegistry(t *testing.T) {
+	for _, name := range []string{"swell", "swell-vrf", "tendermint", "hotstuff", "authority", "dev"} {
+		if engine, err := Engine(name); err != nil || engine == nil {
+			t.Fatalf("engine %v not registered", name)
+		}
+	}
+	if _, err := Engine("breeze"); err != ErrUnknownEngine {
+		t.Fatal("unknown engine accepted")
+	}
+	if err := Register("dev", dev.NewEngine); err != ErrDuplicatedEngine {
+		t.Fatal("engine registered twice")
+	}
+	custom := func(chain *swell.BlockChain, key crypto.PrivateKey) *swell.Communication { return nil }
+	if err := Register("custom", custom); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Engine("custom"); err != nil {
+		t.Fatal("registered engine not found")
+	}
+	names := Names()
+	if len(names) != 7 || names[0] != "authority" || names[len(names)-1] != "tendermint" {
+		t.Fatalf("unexpected names %v", names)
+	}
+}
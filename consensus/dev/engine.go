@@ -0,0 +1,102 @@
+// Package dev implements an instant finality consensus engine for local
+// testing and development.
+package dev
+
+import (
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// Engine is a single node chain. As soon as events are submitted the node
+// builds a block with every event in the pool, signs it and finalizes it on
+// its own, one clock after the other. Blocks, signatures, votes, proposals,
+// evidence and checksums from the network are ignored.
+//
+// All the state is owned by a single goroutine.
+type Engine struct {
+	chain    *swell.BlockChain
+	key      crypto.PrivateKey
+	token    crypto.Token
+	comm     *swell.Communication
+	pool     *swell.EventsPool
+	time     swell.TimeSource
+	sync     *swell.SyncServer
+	built    chan swell.BlockBuild
+	building swell.Overlay
+	err      error // error that stopped the engine
+}
+
+// NewEngine is a swell.ConsensusEngine.
+func NewEngine(chain *swell.BlockChain, key crypto.PrivateKey) *swell.Communication {
+	engine := &Engine{
+		chain: chain,
+		key:   key,
+		token: key.PublicKey(),
+		comm:  swell.NewCommunication(),
+		pool:  swell.NewInstructionPool(),
+		time:  chain.TimeSource(),
+		sync:  swell.NewSyncServer(chain),
+	}
+	go engine.run()
+	return engine.comm
+}
+
+func (e *Engine) run() {
+	for e.err == nil {
+		select {
+		case build := <-e.built:
+			e.built = nil
+			block := build()
+			if len(block.Events) == 0 {
+				// every event was rejected: wait for new ones
+				e.chain.CurrentState.Rollback(e.building)
+				continue
+			}
+			e.finalize(block)
+			if e.pool.Len() > 0 {
+				e.build()
+			}
+		case event := <-e.comm.Events:
+			if e.chain.CurrentState.Validate(event) && e.pool.Queue(event, event.Hash()) && e.built == nil {
+				e.build()
+			}
+		case <-e.comm.IncomingBlock:
+		case <-e.comm.IncomingSignature:
+		case <-e.comm.IncomingVote:
+		case <-e.comm.IncomingProposal:
+		case <-e.comm.IncomingEvidence:
+		case <-e.comm.IncomingChecksum:
+		case peer := <-e.comm.PeerRequest:
+			peer.Response <- e.chain.IsValidator(peer.Token)
+		case validate := <-e.comm.ValidateConn:
+			validate.Ok <- e.chain.IsValidator(validate.Token)
+		case sync := <-e.comm.Synchronization:
+			sync.Response <- e.sync.Serve(sync)
+		}
+	}
+	e.comm.Close()
+	e.comm.Halted <- e.err
+}
+
+// build starts a block with the events in the pool on top of the tip.
+func (e *Engine) build() {
+	parent, tip := e.chain.Tip()
+	e.building = e.chain.CurrentState.Overlay(nil, tip+1)
+	e.built = swell.BlockBuilder(parent, tip, tip+1, e.token, e.time.Now(), e.pool, e.building, e.chain.Params, e.time)
+}
+
+// finalize signs block and commits it.
+func (e *Engine) finalize(block *swell.Block) {
+	block.Sign(e.key)
+	hash := block.Hash()
+	signed := e.chain.AppendCandidate(block)
+	signed.Signatures = []swell.Signature{{Hash: hash, Token: e.token, Signature: e.key.Sign(hash[:])}}
+	if e.err = e.chain.Commit(signed, e.building); e.err != nil {
+		return
+	}
+	e.pool.DeleteEvents(block.Events)
+	e.comm.Checkpoint <- signed
+	if change := e.chain.SetChange(block.Clock, e.key); change != nil {
+		e.comm.SetChange <- change
+	}
+}
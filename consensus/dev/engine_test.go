@@ -0,0 +1,78 @@
+package dev
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/simulation"
+)
+
+func TestInstantFinality(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	chain := &swell.BlockChain{
+		GenesisTime:  time.Now(),
+		TotalStake:   1,
+		Validators:   []swell.Validator{{Token: token, Stake: 1}},
+		CurrentState: &simulation.State{},
+	}
+	comm := swell.LauchNewGenesisConsensus(NewEngine, chain, key)
+	// messages of other engines are ignored
+	comm.IncomingVote <- nil
+	comm.IncomingProposal <- nil
+	comm.IncomingEvidence <- nil
+	comm.IncomingChecksum <- nil
+	timeout := time.After(time.Second)
+	for n := uint64(1); n <= 3; n++ {
+		event := simulation.NewEvent(n)
+		comm.Events <- event
+		select {
+		case signed := <-comm.Checkpoint:
+			hash := signed.Block.Hash()
+			if signed.Block.Clock != n || len(signed.Block.Events) != 1 || !chain.VerifyQuorum(signed) || signed.Signatures[0].Token != token {
+				t.Fatal("invalid checkpoint")
+			}
+			if tip, _ := chain.Tip(); tip != hash {
+				t.Fatal("block not finalized")
+			}
+		case <-timeout:
+			t.Fatal("event not finalized")
+		}
+	}
+}
+
+// failingState cannot commit any block.
+type failingState struct {
+	simulation.State
+}
+
+var errCommit = errors.New("commit failed")
+
+func (s *failingState) Commit(overlay swell.Overlay) error { return errCommit }
+
+func TestHaltOnCommitError(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	chain := &swell.BlockChain{
+		GenesisTime:  time.Now(),
+		TotalStake:   1,
+		Validators:   []swell.Validator{{Token: token, Stake: 1}},
+		CurrentState: &failingState{},
+	}
+	comm := swell.LauchNewGenesisConsensus(NewEngine, chain, key)
+	comm.Events <- simulation.NewEvent(1)
+	select {
+	case err := <-comm.Halted:
+		if !errors.Is(err, errCommit) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	case <-comm.Checkpoint:
+		t.Fatal("block finalized without being committed")
+	case <-time.After(time.Second):
+		t.Fatal("engine did not halt")
+	}
+	if len(chain.RecentBlocks) != 0 {
+		t.Fatal("block finalized without being committed")
+	}
+}
@@ -0,0 +1,485 @@
+// Package hotstuff implements a chained HotStuff consensus engine.
+package hotstuff
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/lienkolabs/swell"
+	slots "github.com/lienkolabs/swell/consensus/swell"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// maxBackoff bounds the doubling of the view timeout after consecutive
+// views without a certificate.
+const maxBackoff = 6
+
+// buildFraction is the fraction of the view timeout the leader spends pulling
+// events from the pool.
+const buildFraction = 4
+
+// maxPending is the maximum number of votes for unknown blocks kept until the
+// block is proposed, for at most pendingViews views.
+const (
+	maxPending   = 1024
+	pendingViews = 2
+)
+
+// maxViewJump is the maximum number of views a proposal moves the node ahead
+// of its view without a certificate of them, so that a faulty leader of a far
+// view cannot push every node there.
+const maxViewJump = 16
+
+// node is a block known to the engine. Its events are applied into overlay on
+// top of the overlay of its parent.
+type node struct {
+	block     *swell.Block
+	justify   *swell.QuorumCertificate // certificate of the parent
+	certified *swell.QuorumCertificate // certificate of the block, once known
+	overlay   swell.Overlay
+}
+
+// votes collects the signatures of a block since view.
+type votes struct {
+	signatures []swell.Signature
+	stake      uint64
+	view       uint64
+}
+
+// Engine is a chained HotStuff engine. Clocks are views. The leader of each
+// view, the slot leader of the clock (see slots.Schedule), proposes a block
+// on top of the highest certified block it knows, carrying the certificate
+// of its parent. Validators sign the block if it extends the block they are
+// locked on or if its certificate is newer than their lock. The signatures
+// are broadcast and a quorum of them certifies the block and moves every
+// node to the next view.
+//
+// A certificate on a block locks its grandparent. The certificate of a chain
+// of three blocks of consecutive views finalizes the first of them and its
+// ancestors.
+//
+// The pacemaker moves to the next view when a view ends without a
+// certificate, doubling the view timeout on each such view.
+//
+// All the state is owned by a single goroutine.
+type Engine struct {
+	chain       *swell.BlockChain
+	key         crypto.PrivateKey
+	token       crypto.Token
+	comm        *swell.Communication
+	pool        *swell.EventsPool
+	timeout     time.Duration
+	time        swell.TimeSource
+	expired     chan uint64 // views whose timeout elapsed
+	schedule    *slots.Schedule
+	set         *swell.ValidatorSet // validators of the finalized tip
+	sync        *swell.SyncServer
+	detector    *swell.EquivocationDetector // evidence received
+	view        uint64
+	voted       uint64 // last view the node signed a block
+	failures    uint   // consecutive views without a certificate
+	nodes       map[crypto.Hash]*node
+	votes       map[crypto.Hash]*votes // votes of known blocks
+	pending     map[crypto.Hash]*votes // votes of blocks not yet known
+	pendingSize int                    // signatures in pending
+	highQC      *swell.QuorumCertificate
+	lockedQC    *swell.QuorumCertificate
+	built       chan swell.BlockBuild
+	building    swell.Overlay
+	justify     *swell.QuorumCertificate // certificate the block being built extends
+	err         error                    // error that stopped the engine
+}
+
+// NewEngine is a swell.ConsensusEngine whose views time out after a slot of
+// the chain calendar.
+func NewEngine(chain *swell.BlockChain, key crypto.PrivateKey) *swell.Communication {
+	return NewEngineWithTimeout(chain.Calendar().SlotDuration)(chain, key)
+}
+
+// NewEngineWithTimeout returns a swell.ConsensusEngine whose views last
+// timeout, the time without a new certificate before the pacemaker moves to
+// the next view, before backoff.
+func NewEngineWithTimeout(timeout time.Duration) swell.ConsensusEngine {
+	return func(chain *swell.BlockChain, key crypto.PrivateKey) *swell.Communication {
+		tip, clock := chain.Tip()
+		genesis := &swell.QuorumCertificate{Clock: clock, Hash: tip}
+		engine := &Engine{
+			chain:    chain,
+			key:      key,
+			token:    key.PublicKey(),
+			comm:     swell.NewCommunication(),
+			pool:     swell.NewInstructionPool(),
+			timeout:  timeout,
+			time:     chain.TimeSource(),
+			expired:  make(chan uint64),
+			sync:     swell.NewSyncServer(chain),
+			detector: swell.NewEquivocationDetector(),
+			view:     clock,
+			voted:    clock,
+			nodes:    make(map[crypto.Hash]*node),
+			votes:    make(map[crypto.Hash]*votes),
+			pending:  make(map[crypto.Hash]*votes),
+			highQC:   genesis,
+			lockedQC: genesis,
+		}
+		engine.updateSchedule()
+		engine.enterView(clock + 1)
+		go engine.run()
+		return engine.comm
+	}
+}
+
+func (e *Engine) run() {
+	for e.err == nil {
+		select {
+		case view := <-e.expired:
+			if view == e.view {
+				e.failures += 1
+				e.enterView(e.view + 1)
+			}
+		case build := <-e.built:
+			e.built = nil
+			block := build()
+			e.proposeBuilt(block)
+		case proposal := <-e.comm.IncomingProposal:
+			if proposal != nil && proposal.Block != nil && proposal.Justify != nil {
+				e.addProposal(proposal)
+			}
+		case signature := <-e.comm.IncomingSignature:
+			if signature != nil {
+				e.addVote(*signature)
+			}
+		case event := <-e.comm.Events:
+			if e.chain.CurrentState.Validate(event) {
+				e.pool.Queue(event, event.Hash())
+			}
+		case peer := <-e.comm.PeerRequest:
+			peer.Response <- e.chain.IsValidator(peer.Token)
+		case validate := <-e.comm.ValidateConn:
+			validate.Ok <- e.chain.IsValidator(validate.Token)
+		case evidence := <-e.comm.IncomingEvidence:
+			if evidence != nil && e.chain.VerifyEvidence(evidence) && e.detector.Add(evidence) {
+				if penalizer, ok := e.chain.CurrentState.(swell.Penalizer); ok {
+					penalizer.Penalize(evidence)
+				}
+			}
+		case sync := <-e.comm.Synchronization:
+			sync.Response <- e.sync.Serve(sync)
+		}
+	}
+	e.comm.Close()
+	e.comm.Halted <- e.err
+}
+
+func (e *Engine) updateSchedule() {
+	_, tip := e.chain.Tip()
+	set := e.chain.ValidatorSet(tip + 1)
+	if e.schedule == nil || (e.chain.Registry != nil && set != e.set) {
+		e.schedule = slots.NewSchedule(e.chain.GenesisHash, e.chain.Calendar(), set.Validators)
+	}
+	e.set = set
+}
+
+// enterView moves to view and, if the node leads it, starts building a block
+// on top of the highest certified block.
+func (e *Engine) enterView(view uint64) {
+	e.view = view
+	e.prunePending()
+	backoff := e.failures
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	e.time.AfterFunc(e.timeout<<backoff, func() { e.expired <- view })
+	if e.schedule.Leader(view) != e.token || e.built != nil {
+		return
+	}
+	_, checkpoint := e.chain.Tip()
+	var parent swell.Overlay
+	if certified, ok := e.nodes[e.highQC.Hash]; ok {
+		parent = certified.overlay
+	}
+	e.justify = e.highQC
+	e.building = e.chain.CurrentState.Overlay(parent, view)
+	finish := e.time.Now().Add(e.timeout / buildFraction)
+	e.built = swell.BlockBuilder(e.highQC.Hash, checkpoint, view, e.token, finish, e.pool, e.building, e.chain.Params, e.time)
+}
+
+// proposeBuilt signs and proposes the block built by the node if it still
+// leads the view and its parent was not finalized away. Otherwise the block
+// is discarded and its events returned to the pool.
+func (e *Engine) proposeBuilt(block *swell.Block) {
+	if block.Clock == e.view && e.extendsTip(e.justify.Hash) {
+		block.Sign(e.key)
+		proposal := swell.NewProposal(0, -1, block, e.justify, e.key)
+		e.comm.Proposal <- proposal
+		e.addNode(proposal, e.building)
+		return
+	}
+	e.chain.CurrentState.Rollback(e.building)
+	for _, event := range block.Events {
+		e.pool.Queue(event, event.Hash())
+	}
+	if e.schedule.Leader(e.view) == e.token {
+		e.enterView(e.view)
+	}
+}
+
+// extendsTip checks if hash is the finalized tip or a block known on top of
+// it.
+func (e *Engine) extendsTip(hash crypto.Hash) bool {
+	tip, _ := e.chain.Tip()
+	_, ok := e.nodes[hash]
+	return ok || hash == tip
+}
+
+// addProposal checks a proposal of the leader of the block view whose
+// certificate is for the parent block and applies its events on top of the
+// parent.
+func (e *Engine) addProposal(proposal *swell.Proposal) {
+	block, justify := proposal.Block, proposal.Justify
+	if _, ok := e.nodes[block.Hash()]; ok || block.Clock <= justify.Clock || block.Parent != justify.Hash {
+		return
+	}
+	if proposal.Token != e.schedule.Leader(block.Clock) || block.Publisher != proposal.Token || !proposal.Verify() {
+		return
+	}
+	parent, known := e.nodes[justify.Hash]
+	tip, clock := e.chain.Tip()
+	if !known && justify.Hash != tip {
+		return
+	}
+	if known && parent.block.Clock != justify.Clock || !known && justify.Clock != clock {
+		return
+	}
+	if !e.verifyCertificate(justify) {
+		return
+	}
+	var overlay swell.Overlay
+	if known {
+		overlay = parent.overlay
+	}
+	if overlay = swell.ValidateBlock(e.chain.CurrentState, overlay, block, e.chain.Params); overlay == nil {
+		return
+	}
+	e.addNode(proposal, overlay)
+}
+
+// verifyCertificate checks the certificate of a block that is not the
+// finalized tip, whose certificate is implied.
+func (e *Engine) verifyCertificate(certificate *swell.QuorumCertificate) bool {
+	if tip, _ := e.chain.Tip(); certificate.Hash == tip {
+		return true
+	}
+	return certificate.Verify(e.chain.ValidatorSet(certificate.Clock))
+}
+
+// addNode incorporates a valid proposal, applies the three-chain rules and
+// signs the block if it is safe.
+func (e *Engine) addNode(proposal *swell.Proposal, overlay swell.Overlay) {
+	block, justify := proposal.Block, proposal.Justify
+	hash := block.Hash()
+	e.nodes[hash] = &node{block: block, justify: justify, overlay: overlay}
+	if pending, ok := e.pending[hash]; ok {
+		delete(e.pending, hash)
+		e.pendingSize -= len(pending.signatures)
+		e.votes[hash] = pending
+	}
+	e.certify(justify)
+	// a certificate proves that a quorum reached its view
+	if e.view <= justify.Clock {
+		e.enterView(justify.Clock + 1)
+	}
+	if e.view < block.Clock && block.Clock <= e.view+maxViewJump {
+		e.enterView(block.Clock)
+	}
+	if block.Clock == e.view && block.Clock > e.voted && e.safe(block, justify) && e.set.Stake(e.token) > 0 {
+		e.voted = block.Clock
+		signature := swell.Signature{Hash: hash, Token: e.token, Signature: e.key.Sign(hash[:])}
+		e.comm.BlockSignature <- &signature
+		e.addVote(signature)
+	}
+	if collected, ok := e.votes[hash]; ok && e.quorum(collected.stake) {
+		e.certified(block, collected.signatures)
+	}
+}
+
+// safe is the voting rule: block extends the locked block or its
+// certificate is newer than the lock.
+func (e *Engine) safe(block *swell.Block, justify *swell.QuorumCertificate) bool {
+	return justify.Clock > e.lockedQC.Clock || e.extends(block.Parent, e.lockedQC.Hash)
+}
+
+// extends checks if the block hash is ancestor or descends from ancestor.
+func (e *Engine) extends(hash, ancestor crypto.Hash) bool {
+	for {
+		if hash == ancestor {
+			return true
+		}
+		current, ok := e.nodes[hash]
+		if !ok {
+			// the finalized tip descends from every locked block
+			tip, _ := e.chain.Tip()
+			return hash == tip && e.nodes[ancestor] == nil
+		}
+		hash = current.block.Parent
+	}
+}
+
+// certify records the certificate of a block and applies the chained rules:
+// the highest certificate is kept to build on, the grandparent of the
+// certified block is locked and, for three blocks of consecutive views, the
+// first is finalized.
+func (e *Engine) certify(certificate *swell.QuorumCertificate) {
+	if certificate.Clock > e.highQC.Clock {
+		e.highQC = certificate
+	}
+	two, ok := e.nodes[certificate.Hash]
+	if !ok {
+		return
+	}
+	two.certified = certificate
+	one, ok := e.nodes[two.justify.Hash]
+	if !ok {
+		return
+	}
+	if two.justify.Clock > e.lockedQC.Clock {
+		e.lockedQC = two.justify
+	}
+	zero, ok := e.nodes[one.justify.Hash]
+	if !ok {
+		return
+	}
+	if two.block.Clock == one.block.Clock+1 && one.block.Clock == zero.block.Clock+1 {
+		e.finalize(zero)
+	}
+}
+
+func (e *Engine) quorum(stake uint64) bool {
+	return 3*stake > 2*e.set.TotalStake
+}
+
+// addVote collects a signature of a validator. Signatures of blocks not yet
+// known are kept pending until the block arrives.
+func (e *Engine) addVote(signature swell.Signature) {
+	stake := e.set.Stake(signature.Token)
+	if stake == 0 {
+		return
+	}
+	collecting := e.votes
+	_, known := e.nodes[signature.Hash]
+	if !known {
+		if e.pendingSize >= maxPending {
+			return
+		}
+		collecting = e.pending
+	}
+	collected, ok := collecting[signature.Hash]
+	if ok {
+		for _, existing := range collected.signatures {
+			if existing.Token == signature.Token {
+				return
+			}
+		}
+	}
+	if !signature.Token.VerifyZIP215(signature.Hash[:], signature.Signature) {
+		return
+	}
+	if !ok {
+		collected = &votes{view: e.view}
+		collecting[signature.Hash] = collected
+	}
+	collected.signatures = append(collected.signatures, signature)
+	collected.stake += stake
+	if !known {
+		e.pendingSize += 1
+		return
+	}
+	if e.quorum(collected.stake) {
+		e.certified(e.nodes[signature.Hash].block, collected.signatures)
+	}
+}
+
+// prunePending forgets the votes of blocks still unknown pendingViews views
+// after their first vote.
+func (e *Engine) prunePending() {
+	for hash, pending := range e.pending {
+		if pending.view+pendingViews < e.view {
+			delete(e.pending, hash)
+			e.pendingSize -= len(pending.signatures)
+		}
+	}
+}
+
+// certified handles a certificate formed by the node from the signatures it
+// collected and moves on to the next view.
+func (e *Engine) certified(block *swell.Block, signatures []swell.Signature) {
+	hash := block.Hash()
+	if e.nodes[hash].certified != nil {
+		return
+	}
+	e.certify(&swell.QuorumCertificate{Clock: block.Clock, Hash: hash, Signatures: signatures})
+	e.failures = 0
+	if block.Clock >= e.view {
+		e.enterView(block.Clock + 1)
+	}
+}
+
+// finalize finalizes the block of final and every ancestor not yet final,
+// oldest first, and discards the blocks that do not descend from it. If a
+// block cannot be committed the engine stops.
+func (e *Engine) finalize(final *node) {
+	tip, _ := e.chain.Tip()
+	path := make([]*node, 0)
+	for current := final; current != nil && current.block.Hash() != tip; current = e.nodes[current.block.Parent] {
+		path = append(path, current)
+	}
+	for n := len(path) - 1; n >= 0; n-- {
+		current := path[n]
+		signed := e.chain.AppendCandidate(current.block)
+		signed.Signatures = current.certified.Signatures
+		if e.err = e.chain.Commit(signed, current.overlay); e.err != nil {
+			return
+		}
+		e.pool.DeleteEvents(current.block.Events)
+		e.comm.Checkpoint <- signed
+		if change := e.chain.SetChange(signed.Block.Clock, e.key); change != nil {
+			e.comm.SetChange <- change
+		}
+	}
+	e.prune(final)
+	e.updateSchedule()
+	if clock := final.block.Clock; clock > swell.EvidenceWindow {
+		e.detector.Prune(clock - swell.EvidenceWindow)
+	}
+}
+
+// prune forgets the finalized blocks and rolls back every block that does
+// not descend from final.
+func (e *Engine) prune(final *node) {
+	hash := final.block.Hash()
+	discarded := make(map[crypto.Hash]*node)
+	for other, known := range e.nodes {
+		if known.block.Clock <= final.block.Clock || !e.extends(known.block.Parent, hash) {
+			discarded[other] = known
+		}
+	}
+	// oldest first, so that rollbacks happen in the same order on every run
+	hashes := make([]crypto.Hash, 0, len(discarded))
+	for other := range discarded {
+		hashes = append(hashes, other)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		first, second := discarded[hashes[i]].block.Clock, discarded[hashes[j]].block.Clock
+		return first < second || first == second && bytes.Compare(hashes[i][:], hashes[j][:]) < 0
+	})
+	for _, other := range hashes {
+		known := discarded[other]
+		// rolling back a parent rolls back its descendants
+		if _, ok := discarded[known.block.Parent]; !ok && known.block.Clock > final.block.Clock {
+			e.chain.CurrentState.Rollback(known.overlay)
+		}
+		delete(e.nodes, other)
+		delete(e.votes, other)
+	}
+}
@@ -0,0 +1,165 @@
+package hotstuff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell"
+	slots "github.com/lienkolabs/swell/consensus/swell"
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/simulation"
+)
+
+const testTimeout = 200 * time.Millisecond
+
+// testNetwork starts an engine for each of the first running keys and
+// connects them. Every validator holds the same stake.
+func testNetwork(keys []crypto.PrivateKey, running int) ([]*swell.Communication, *swell.BlockChain) {
+	validators := make([]swell.Validator, len(keys))
+	for n, key := range keys {
+		validators[n] = swell.Validator{Token: key.PublicKey(), Stake: 10}
+	}
+	newChain := func() *swell.BlockChain {
+		return &swell.BlockChain{
+			GenesisHash:  crypto.Hasher([]byte("hotstuff")),
+			GenesisTime:  time.Now(),
+			TotalStake:   10 * uint64(len(keys)),
+			Validators:   validators,
+			CurrentState: &simulation.State{},
+		}
+	}
+	comms := make([]*swell.Communication, running)
+	for n := range comms {
+		comms[n] = swell.LauchNewGenesisConsensus(NewEngineWithTimeout(testTimeout), newChain(), keys[n])
+	}
+	for n := range comms {
+		go func(from int) {
+			for {
+				select {
+				case proposal := <-comms[from].Proposal:
+					for to, comm := range comms {
+						if to != from {
+							go func(comm *swell.Communication) { comm.IncomingProposal <- proposal }(comm)
+						}
+					}
+				case signature := <-comms[from].BlockSignature:
+					for to, comm := range comms {
+						if to != from {
+							go func(comm *swell.Communication) { comm.IncomingSignature <- signature }(comm)
+						}
+					}
+				}
+			}
+		}(n)
+	}
+	return comms, newChain()
+}
+
+func testKeys(count int) []crypto.PrivateKey {
+	keys := make([]crypto.PrivateKey, count)
+	for n := range keys {
+		_, keys[n] = crypto.RandomAsymetricKey()
+	}
+	return keys
+}
+
+// finalized collects the blocks finalized by every node until one past
+// clock.
+func finalized(t *testing.T, comms []*swell.Communication, clock uint64) [][]*swell.SignedBlock {
+	blocks := make([][]*swell.SignedBlock, len(comms))
+	timeout := time.After(20 * time.Second)
+	for n, comm := range comms {
+		for len(blocks[n]) == 0 || blocks[n][len(blocks[n])-1].Block.Clock <= clock {
+			select {
+			case signed := <-comm.Checkpoint:
+				blocks[n] = append(blocks[n], signed)
+			case <-timeout:
+				t.Fatalf("node %v finalized %v blocks", n, len(blocks[n]))
+			}
+		}
+	}
+	return blocks
+}
+
+// checkChain checks that every node finalized the same chain of certified
+// blocks.
+func checkChain(t *testing.T, blocks [][]*swell.SignedBlock, chain *swell.BlockChain) {
+	parent := chain.GenesisHash
+	for n, signed := range blocks[0] {
+		if signed.Block.Parent != parent || !chain.VerifyQuorum(signed) {
+			t.Fatalf("invalid finalized block for clock %v", signed.Block.Clock)
+		}
+		parent = signed.Block.Hash()
+		for _, node := range blocks {
+			if n < len(node) && node[n].Block.Hash() != parent {
+				t.Fatalf("nodes finalized different blocks for clock %v", signed.Block.Clock)
+			}
+		}
+	}
+}
+
+func TestFinalizesEvents(t *testing.T) {
+	comms, chain := testNetwork(testKeys(4), 4)
+	event := simulation.NewEvent(1)
+	for _, comm := range comms {
+		comm.Events <- event
+	}
+	blocks := finalized(t, comms, 3)
+	checkChain(t, blocks, chain)
+	included := false
+	for _, signed := range blocks[0] {
+		for _, finalized := range signed.Block.Events {
+			included = included || finalized.Hash() == event.Hash()
+		}
+	}
+	if !included {
+		t.Fatal("event was not finalized")
+	}
+}
+
+func TestViewChangePastSilentLeader(t *testing.T) {
+	keys := testKeys(4)
+	comms, chain := testNetwork(keys, 3)
+	schedule := slots.NewSchedule(chain.GenesisHash, chain.Calendar(), chain.Validators)
+	clock := uint64(1)
+	for schedule.Leader(clock) != keys[3].PublicKey() {
+		clock += 1
+	}
+	blocks := finalized(t, comms, clock)
+	checkChain(t, blocks, chain)
+	for _, signed := range blocks[0] {
+		if signed.Block.Publisher == keys[3].PublicKey() {
+			t.Fatal("block of silent leader finalized")
+		}
+	}
+}
+
+func TestVotesOfUnknownBlocks(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	_, other := crypto.RandomAsymetricKey()
+	e := &Engine{
+		set:     swell.NewValidatorSet(0, []swell.Validator{{Token: key.PublicKey(), Stake: 1}, {Token: other.PublicKey(), Stake: 1}}),
+		nodes:   make(map[crypto.Hash]*node),
+		votes:   make(map[crypto.Hash]*votes),
+		pending: make(map[crypto.Hash]*votes),
+	}
+	sign := func(hash crypto.Hash) swell.Signature {
+		return swell.Signature{Hash: hash, Token: key.PublicKey(), Signature: key.Sign(hash[:])}
+	}
+	// a validator floods the node with signatures of blocks never proposed
+	for n := 0; n <= maxPending; n++ {
+		e.addVote(sign(crypto.Hasher([]byte{byte(n), byte(n >> 8)})))
+	}
+	if e.pendingSize != maxPending || len(e.pending) != maxPending {
+		t.Fatalf("%v pending votes kept", e.pendingSize)
+	}
+	known := crypto.Hasher([]byte("known"))
+	e.nodes[known] = &node{}
+	if e.addVote(sign(known)); e.votes[known] == nil {
+		t.Fatal("vote of a known block dropped")
+	}
+	e.view = pendingViews + 1
+	if e.prunePending(); e.pendingSize != 0 || len(e.pending) != 0 {
+		t.Fatal("pending votes not pruned")
+	}
+}
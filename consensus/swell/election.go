@@ -0,0 +1,58 @@
+package swell
+
+import (
+	"math/bits"
+
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/util"
+)
+
+// With VRF election the leaders of a clock are not public. Every validator
+// evaluates its VRF over the epoch seed and the clock and is elected if the
+// output falls below a threshold proportional to its stake, so that on
+// average one validator is elected per clock. The elected validator attaches
+// the VRF proof to its block and everyone else verifies it.
+//
+// Epochs follow the chain calendar. The seed of an epoch mixes the genesis
+// with the last block finalized before the epoch preceding it, so that the
+// leaders of an epoch are not known from the genesis on and every node
+// derives them from the finalized chain alone.
+
+// EpochSeed returns the election seed of epoch given its seed anchor (see
+// swell.BlockChain.SeedAnchor), crypto.ZeroHash if the seeds depend only on
+// the genesis.
+func EpochSeed(genesis crypto.Hash, epoch uint64, anchor crypto.Hash) crypto.Hash {
+	bytes := make([]byte, 0)
+	util.PutHash(genesis, &bytes)
+	util.PutUint64(epoch, &bytes)
+	util.PutHash(anchor, &bytes)
+	return crypto.Hasher(bytes)
+}
+
+// ElectionInput is the VRF input of the election for clock, with seed the
+// seed of the epoch of clock.
+func ElectionInput(seed crypto.Hash, clock uint64) []byte {
+	bytes := make([]byte, 0)
+	util.PutHash(seed, &bytes)
+	util.PutUint64(clock, &bytes)
+	return bytes
+}
+
+// IsElected checks if the VRF output of a validator with stake out of total
+// elects it. The first 8 bytes of output, read as a big-endian number, must
+// be below 2^64 * stake / total. Only integer arithmetic is used so that
+// every node reaches the same result.
+func IsElected(output crypto.VRFOutput, stake, total uint64) bool {
+	if stake == 0 || total == 0 {
+		return false
+	}
+	if stake >= total {
+		return true
+	}
+	threshold, _ := bits.Div64(stake, 0, total)
+	value := uint64(0)
+	for n := 0; n < 8; n++ {
+		value = value<<8 | uint64(output[n])
+	}
+	return value < threshold
+}
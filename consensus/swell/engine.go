@@ -0,0 +1,447 @@
+package swell
+
+import (
+	"time"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// slotBuildFraction is the fraction of the slot the leader spends pulling
+// events from the pool before publishing its block.
+const slotBuildFraction = 2
+
+// Engine is the swell consensus engine. For every clock a slot leader chosen
+// by the Schedule builds a block from the events pool and publishes it. Every
+// validator checks the block, signs it and publishes its signature. Once the
+// signatures of candidate reach more than two thirds of the total stake the
+// candidate is finalized and published as a new checkpoint.
+//
+// Blocks are applied into pending overlays of the chain state as they become
+// candidates. Only candidates on top of the last finalized block are signed
+// and finalized. The overlay of the finalized candidate is committed and the
+// candidates that do not extend it are rolled back.
+//
+// All the state is owned by a single goroutine.
+type Engine struct {
+	chain       *swell.BlockChain
+	key         crypto.PrivateKey
+	token       crypto.Token
+	comm        *swell.Communication
+	pool        *swell.EventsPool
+	time        swell.TimeSource
+	calendar    swell.Calendar
+	slot        chan struct{}
+	schedule    *Schedule
+	scheduleSet *swell.ValidatorSet // validator set of the schedule
+	clock       uint64
+	overlays    map[crypto.Hash]swell.Overlay
+	pending     map[crypto.Hash]*pendingSignatures // signatures of blocks not yet received
+	pendingSize int                                // signatures in pending
+	sync        *swell.SyncServer
+	detector    *swell.EquivocationDetector
+	// checksums of the current and previous epochs
+	checksums     map[uint64]*swell.ChecksumAggregator
+	checksumEpoch uint64
+	checksumClock uint64
+	checksumBlock crypto.Hash // finalized block of checksumClock
+	checksumSet   []byte      // serialized registry at checksumClock
+	checksumJob   chan crypto.Hash
+	vrf           bool   // leaders are elected by VRF instead of the Schedule
+	signed        uint64 // last clock for which the node signed a block
+	err           error  // error that stopped the engine
+}
+
+// maxPending is the maximum number of signatures of blocks not yet received
+// kept until the block arrives, for at most pendingSlots slots.
+const (
+	maxPending   = 1024
+	pendingSlots = 2
+)
+
+type pendingSignatures struct {
+	clock      uint64 // clock of the slot the first signature arrived
+	signatures []swell.Signature
+}
+
+// NewEngine is a swell.ConsensusEngine with the public leader Schedule.
+func NewEngine(chain *swell.BlockChain, key crypto.PrivateKey) *swell.Communication {
+	return newEngine(chain, key, false)
+}
+
+// NewVRFEngine is a swell.ConsensusEngine with private VRF leader election
+// (see IsElected).
+func NewVRFEngine(chain *swell.BlockChain, key crypto.PrivateKey) *swell.Communication {
+	return newEngine(chain, key, true)
+}
+
+func newEngine(chain *swell.BlockChain, key crypto.PrivateKey, vrf bool) *swell.Communication {
+	engine := &Engine{
+		chain:     chain,
+		key:       key,
+		token:     key.PublicKey(),
+		comm:      swell.NewCommunication(),
+		pool:      swell.NewInstructionPool(),
+		time:      chain.TimeSource(),
+		calendar:  chain.Calendar(),
+		slot:      make(chan struct{}),
+		clock:     chain.Epoch,
+		overlays:  make(map[crypto.Hash]swell.Overlay),
+		pending:   make(map[crypto.Hash]*pendingSignatures),
+		sync:      swell.NewSyncServer(chain),
+		detector:  swell.NewEquivocationDetector(),
+		checksums: make(map[uint64]*swell.ChecksumAggregator),
+		vrf:       vrf,
+	}
+	engine.checksumEpoch = engine.calendar.Epoch(engine.clock)
+	// a node starting late does not lead or sign the slots already gone
+	if current := engine.calendar.ClockAt(engine.time.Now()); current > engine.clock+1 {
+		engine.clock = current - 1
+	}
+	engine.updateSchedule()
+	engine.nextSlot()
+	go engine.run()
+	return engine.comm
+}
+
+// updateSchedule creates the leader schedule for the current validator set
+// if it changed since the schedule was created. Seeds are taken from the
+// finalized blocks of the chain.
+func (e *Engine) updateSchedule() {
+	set := e.chain.ValidatorSet(e.clock + 1)
+	if e.scheduleSet != nil && (e.chain.Registry == nil || set == e.scheduleSet) {
+		return
+	}
+	e.schedule, e.scheduleSet = NewSchedule(e.chain.GenesisHash, e.calendar, set.Validators), set
+	e.schedule.SeedFrom(e.chain)
+}
+
+// Leader returns the token of the validator in charge of the block for clock.
+func (e *Engine) Leader(clock uint64) crypto.Token {
+	return e.schedule.Leader(clock)
+}
+
+// elected checks if the node leads clock and returns the proof to attach to
+// its block.
+func (e *Engine) elected(clock uint64) (crypto.VRFProof, bool) {
+	if !e.vrf {
+		return crypto.VRFProof{}, e.Leader(clock) == e.token
+	}
+	seed, ok := e.schedule.Seed(clock)
+	if !ok {
+		return crypto.VRFProof{}, false
+	}
+	set := e.chain.ValidatorSet(clock)
+	proof, output := e.key.VRFProve(ElectionInput(seed, clock))
+	return proof, IsElected(output, set.Stake(e.token), set.TotalStake)
+}
+
+// isLeader checks if the publisher of block leads its clock.
+func (e *Engine) isLeader(block *swell.Block) bool {
+	if !e.vrf {
+		return block.Publisher == e.Leader(block.Clock)
+	}
+	seed, ok := e.schedule.Seed(block.Clock)
+	if !ok {
+		return false
+	}
+	output, ok := block.Publisher.VRFVerify(ElectionInput(seed, block.Clock), block.Proof)
+	set := e.chain.ValidatorSet(block.Clock)
+	return ok && IsElected(output, set.Stake(block.Publisher), set.TotalStake)
+}
+
+// nextSlot schedules the end of the slot of clock and returns the time left
+// until then.
+func (e *Engine) nextSlot() time.Duration {
+	next := e.calendar.Until(e.clock, e.time.Now())
+	e.time.AfterFunc(next, func() { e.slot <- struct{}{} })
+	return next
+}
+
+func (e *Engine) run() {
+	var built chan swell.BlockBuild
+	var building swell.Overlay
+	var proof crypto.VRFProof
+	for e.err == nil {
+		select {
+		case <-e.slot:
+			e.clock += 1
+			e.prunePending()
+			next := e.nextSlot()
+			var elected bool
+			if proof, elected = e.elected(e.clock); elected {
+				parent, checkpoint := e.chain.Tip()
+				finish := e.time.Now().Add(next / slotBuildFraction)
+				building = e.chain.CurrentState.Overlay(nil, e.clock)
+				built = swell.BlockBuilder(parent, checkpoint, e.clock, e.token, finish, e.pool, building, e.chain.Params, e.time)
+			}
+		case build := <-built:
+			built = nil
+			block := build()
+			if parent, _ := e.chain.Tip(); block.Parent != parent {
+				// a block was finalized while building: the events go back
+				// to the pool
+				e.chain.CurrentState.Rollback(building)
+				for _, event := range block.Events {
+					e.pool.Queue(event, event.Hash())
+				}
+				continue
+			}
+			block.Proof = proof
+			block.Sign(e.key)
+			e.comm.NewBlock <- block
+			e.incorporate(block, building)
+		case block := <-e.comm.IncomingBlock:
+			if block != nil && e.isLeader(block) {
+				e.denounce(e.detector.Block(block))
+				if e.validate(block) {
+					if overlay := swell.ValidateBlock(e.chain.CurrentState, nil, block, e.chain.Params); overlay != nil {
+						e.incorporate(block, overlay)
+					}
+				}
+			}
+		case signature := <-e.comm.IncomingSignature:
+			if signature != nil {
+				e.appendSignature(*signature)
+			}
+		case event := <-e.comm.Events:
+			if e.chain.CurrentState.Validate(event) {
+				e.pool.Queue(event, event.Hash())
+			}
+		case peer := <-e.comm.PeerRequest:
+			peer.Response <- e.chain.IsValidator(peer.Token)
+		case validate := <-e.comm.ValidateConn:
+			validate.Ok <- e.chain.IsValidator(validate.Token)
+		case evidence := <-e.comm.IncomingEvidence:
+			if evidence != nil && e.chain.VerifyEvidence(evidence) && e.detector.Add(evidence) {
+				e.penalize(evidence)
+			}
+		case sync := <-e.comm.Synchronization:
+			sync.Response <- e.sync.Serve(sync)
+		case hash := <-e.checksumJob:
+			e.checksumJob = nil
+			e.ownChecksum(e.checksumClock, swell.CheckpointChecksum(hash, e.checksumBlock, e.checksumSet))
+		case checksum := <-e.comm.IncomingChecksum:
+			if checksum != nil && e.validChecksum(checksum) {
+				if aggregator := e.aggregator(checksum.Clock); aggregator != nil && aggregator.Add(checksum) {
+					e.checkAgreement(checksum.Clock, aggregator)
+				}
+			}
+		}
+	}
+	e.comm.Close()
+	e.comm.Halted <- e.err
+}
+
+// validate checks that block, from the leader of its slot, was published on
+// top of the last finalized block, with its clock as checkpoint, and is not
+// older than the tip. Seed anchors rely on the checkpoint of finalized blocks.
+func (e *Engine) validate(block *swell.Block) bool {
+	parent, tip := e.chain.Tip()
+	if block.Clock <= tip || block.Clock > e.clock+1 || block.Parent != parent || block.CheckPoint != tip {
+		return false
+	}
+	return e.chain.Candidate(block.Clock, block.Hash()) == nil
+}
+
+// incorporate makes block, with its events applied into overlay, a candidate
+// and, if the node is a validator, signs and publishes its signature. A
+// validator signs only the first block it receives for a clock, and only if
+// it extends the last finalized block. Signatures of the block received
+// before it are then appended.
+func (e *Engine) incorporate(block *swell.Block, overlay swell.Overlay) {
+	hash := block.Hash()
+	e.chain.AppendCandidate(block)
+	e.overlays[hash] = overlay
+	parent, _ := e.chain.Tip()
+	if e.chain.Stake(e.token) > 0 && block.Clock > e.signed && block.Parent == parent {
+		e.signed = block.Clock
+		signature := &swell.Signature{Hash: hash, Token: e.token, Signature: e.key.Sign(hash[:])}
+		e.comm.BlockSignature <- signature
+		e.appendSignatureForClock(block.Clock, *signature)
+	}
+	if pending, ok := e.pending[hash]; ok {
+		delete(e.pending, hash)
+		e.pendingSize -= len(pending.signatures)
+		for _, signature := range pending.signatures {
+			e.appendSignatureForClock(block.Clock, signature)
+		}
+	}
+}
+
+// appendSignature appends signature to its candidate. Valid signatures of
+// validators for blocks not yet received are kept until the block arrives.
+func (e *Engine) appendSignature(signature swell.Signature) {
+	_, tip := e.chain.Tip()
+	for clock, candidates := range e.chain.CandidateBlocks {
+		if clock <= tip {
+			continue
+		}
+		for _, candidate := range candidates {
+			if candidate.Block.Hash() == signature.Hash {
+				e.appendSignatureForClock(clock, signature)
+				return
+			}
+		}
+	}
+	if e.pendingSize >= maxPending || e.chain.Stake(signature.Token) == 0 {
+		return
+	}
+	pending, ok := e.pending[signature.Hash]
+	if !ok {
+		pending = &pendingSignatures{clock: e.clock}
+	}
+	for _, existing := range pending.signatures {
+		if existing.Token == signature.Token {
+			return
+		}
+	}
+	if !signature.Token.VerifyZIP215(signature.Hash[:], signature.Signature) {
+		return
+	}
+	pending.signatures = append(pending.signatures, signature)
+	e.pending[signature.Hash] = pending
+	e.pendingSize += 1
+}
+
+// prunePending forgets the signatures kept for more than pendingSlots slots.
+func (e *Engine) prunePending() {
+	for hash, pending := range e.pending {
+		if pending.clock+pendingSlots < e.clock {
+			delete(e.pending, hash)
+			e.pendingSize -= len(pending.signatures)
+		}
+	}
+}
+
+// appendSignatureForClock appends signature to the candidate of clock it
+// signs and finalizes the candidate once signed by a quorum, if it extends the
+// last finalized block. If the candidate cannot be committed the engine stops.
+func (e *Engine) appendSignatureForClock(clock uint64, signature swell.Signature) {
+	candidate := e.chain.AppendSignature(clock, signature)
+	if candidate == nil {
+		return
+	}
+	e.denounce(e.detector.Signature(candidate.Block, signature))
+	if parent, _ := e.chain.Tip(); candidate.Block.Parent != parent || !e.chain.HasQuorum(candidate.Signatures) {
+		return
+	}
+	hash := candidate.Block.Hash()
+	overlay := e.overlays[hash]
+	delete(e.overlays, hash)
+	for _, competing := range e.chain.CandidateBlocks[clock] {
+		e.discard(competing)
+	}
+	if e.err = e.chain.Commit(candidate, overlay); e.err != nil {
+		return
+	}
+	e.updateSchedule()
+	// the overlays of the other candidates were applied on top of the
+	// previous tip
+	for other, candidates := range e.chain.CandidateBlocks {
+		kept := make(swell.SignedBlocks, 0)
+		for _, remaining := range candidates {
+			if remaining.Block.Parent == hash {
+				kept = append(kept, remaining)
+			} else {
+				e.discard(remaining)
+			}
+		}
+		if len(kept) == 0 {
+			delete(e.chain.CandidateBlocks, other)
+		} else {
+			e.chain.CandidateBlocks[other] = kept
+		}
+	}
+	e.pool.DeleteEvents(candidate.Block.Events)
+	if clock > swell.EvidenceWindow {
+		e.detector.Prune(clock - swell.EvidenceWindow)
+	}
+	if epoch := e.calendar.Epoch(clock); epoch > e.checksumEpoch {
+		// the first block finalized in a new epoch is the same for every
+		// node, so is the checkpoint of the checksum
+		e.checksumEpoch = epoch
+		e.checksumClock = clock
+		e.checksumBlock = hash
+		e.checksumSet = swell.SerializeRegistry(e.chain)
+		e.checksumJob = e.chain.CurrentState.ChecksumJob()
+	}
+	e.comm.Checkpoint <- candidate
+	if change := e.chain.SetChange(clock, e.key); change != nil {
+		e.comm.SetChange <- change
+	}
+}
+
+// validChecksum checks that checksum is signed by a validator of its clock,
+// so that only validators create aggregators.
+func (e *Engine) validChecksum(checksum *swell.StateChecksum) bool {
+	return e.chain.ValidatorSet(checksum.Clock).Stake(checksum.Token) > 0 && checksum.Verify()
+}
+
+// aggregator returns the checksum aggregator for clock, or nil if clock is
+// not in the current or previous epoch.
+func (e *Engine) aggregator(clock uint64) *swell.ChecksumAggregator {
+	if epoch := e.calendar.Epoch(clock); epoch > e.checksumEpoch+1 || epoch+2 <= e.checksumEpoch {
+		return nil
+	}
+	if aggregator, ok := e.checksums[clock]; ok {
+		return aggregator
+	}
+	for old := range e.checksums {
+		if e.calendar.Epoch(old)+2 <= e.checksumEpoch {
+			delete(e.checksums, old)
+		}
+	}
+	aggregator := swell.NewChecksumAggregator(clock, e.chain.ValidatorSet(clock))
+	e.checksums[clock] = aggregator
+	return aggregator
+}
+
+// ownChecksum publishes, if the node is a validator, the checkpoint checksum
+// of clock.
+func (e *Engine) ownChecksum(clock uint64, hash crypto.Hash) {
+	aggregator := e.aggregator(clock)
+	if aggregator == nil {
+		return
+	}
+	aggregator.SetOwn(hash)
+	if e.chain.ValidatorSet(clock).Stake(e.token) > 0 {
+		checksum := swell.NewStateChecksum(clock, hash, e.key)
+		e.comm.Checksum <- checksum
+		aggregator.Add(checksum)
+	}
+	e.checkAgreement(clock, aggregator)
+}
+
+// checkAgreement denounces the divergence of the node from the checksum
+// agreed for clock, if any.
+func (e *Engine) checkAgreement(clock uint64, aggregator *swell.ChecksumAggregator) {
+	if denunciation := aggregator.Divergence(); denunciation != nil {
+		e.comm.ChecksumDiverged <- denunciation
+	}
+}
+
+// denounce publishes new evidence found by the detector, if any, and hands it
+// to the state.
+func (e *Engine) denounce(evidence *swell.Evidence) {
+	if evidence == nil {
+		return
+	}
+	e.comm.Evidence <- evidence
+	e.penalize(evidence)
+}
+
+func (e *Engine) penalize(evidence *swell.Evidence) {
+	if penalizer, ok := e.chain.CurrentState.(swell.Penalizer); ok {
+		penalizer.Penalize(evidence)
+	}
+}
+
+// discard rolls back the overlay of a candidate that will not be finalized.
+func (e *Engine) discard(candidate *swell.SignedBlock) {
+	hash := candidate.Block.Hash()
+	if overlay, ok := e.overlays[hash]; ok {
+		e.chain.CurrentState.Rollback(overlay)
+		delete(e.overlays, hash)
+	}
+}
@@ -0,0 +1,125 @@
+package swell
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/simulation"
+)
+
+func TestSingleValidatorFinalizesEvents(t *testing.T) {
+	for _, engine := range []swell.ConsensusEngine{NewEngine, NewVRFEngine} {
+		testSingleValidator(t, engine)
+	}
+}
+
+func testSingleValidator(t *testing.T, engine swell.ConsensusEngine) {
+	token, key := crypto.RandomAsymetricKey()
+	chain := &swell.BlockChain{
+		GenesisTime:  time.Now(),
+		TotalStake:   1000,
+		Validators:   []swell.Validator{{Token: token, Stake: 1000}},
+		CurrentState: &simulation.State{},
+	}
+	comm := swell.LauchNewGenesisConsensus(engine, chain, key)
+	event := simulation.NewEvent(1)
+	comm.Events <- event
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case signed := <-comm.Checkpoint:
+			if len(signed.Signatures) != 1 || signed.Signatures[0].Token != token {
+				t.Fatal("checkpoint without validator signature")
+			}
+			if len(signed.Block.Events) == 1 && signed.Block.Events[0].Hash() == event.Hash() {
+				return
+			}
+		case <-comm.NewBlock:
+		case <-comm.BlockSignature:
+		case <-timeout:
+			t.Fatal("event was not finalized")
+		}
+	}
+}
+
+func TestSignaturesBeforeBlock(t *testing.T) {
+	keys := make([]crypto.PrivateKey, 4)
+	validators := make([]swell.Validator, len(keys))
+	for n := range keys {
+		_, keys[n] = crypto.RandomAsymetricKey()
+		validators[n] = swell.Validator{Token: keys[n].PublicKey(), Stake: 10}
+	}
+	chain := &swell.BlockChain{
+		GenesisTime:  time.Now(),
+		SlotDuration: time.Hour,
+		TotalStake:   40,
+		Validators:   validators,
+		CurrentState: &simulation.State{},
+	}
+	leader := 0
+	for n, key := range keys {
+		if key.PublicKey() == NewSchedule(chain.GenesisHash, chain.Calendar(), validators).Leader(1) {
+			leader = n
+		}
+	}
+	// the node is not the leader, which signs with another validator before
+	// the node gets the block
+	node := keys[(leader+1)%4]
+	others := []crypto.PrivateKey{keys[leader], keys[(leader+2)%4]}
+	comm := swell.LauchNewGenesisConsensus(NewEngine, chain, node)
+	block := &swell.Block{Clock: 1, Parent: chain.GenesisHash, Publisher: keys[leader].PublicKey(), PublishedAt: time.Now(), Events: swell.Events{simulation.NewEvent(1)}}
+	block.Sign(keys[leader])
+	hash := block.Hash()
+	for _, key := range others {
+		comm.IncomingSignature <- &swell.Signature{Hash: hash, Token: key.PublicKey(), Signature: key.Sign(hash[:])}
+	}
+	comm.IncomingBlock <- block
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case signed := <-comm.Checkpoint:
+			if signed.Block.Hash() != hash || len(signed.Signatures) != 3 {
+				t.Fatal("unexpected checkpoint")
+			}
+			return
+		case <-comm.BlockSignature:
+		case <-timeout:
+			t.Fatal("block was not finalized with the early signatures")
+		}
+	}
+}
+
+func TestElection(t *testing.T) {
+	seed := EpochSeed(crypto.Hasher([]byte("genesis")), 0, crypto.ZeroHash)
+	stakes := []uint64{1, 1, 2, 4}
+	keys := make([]crypto.PrivateKey, len(stakes))
+	for n := range keys {
+		_, keys[n] = crypto.RandomAsymetricKey()
+	}
+	clocks := 800
+	elected := make([]int, len(stakes))
+	for clock := 0; clock < clocks; clock++ {
+		input := ElectionInput(seed, uint64(clock))
+		for n, key := range keys {
+			proof, output := key.VRFProve(input)
+			if clock < 10 {
+				if verified, ok := key.PublicKey().VRFVerify(input, proof); !ok || verified != output {
+					t.Fatal("election proof rejected")
+				}
+			}
+			if IsElected(output, stakes[n], 8) {
+				elected[n] += 1
+			}
+		}
+	}
+	for n, count := range elected {
+		// binomial with p = stake/8, accept 5 standard deviations
+		expected := float64(clocks) * float64(stakes[n]) / 8
+		if deviation := math.Abs(float64(count) - expected); deviation > 5*math.Sqrt(expected) {
+			t.Errorf("validator with stake %v elected %v times, expected about %v", stakes[n], count, expected)
+		}
+	}
+}
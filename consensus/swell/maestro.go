@@ -1,8 +1,5 @@
 package swell
 
-const ChecksumWindows = 50000
-const ValidatorsCount = 10
-
 /*
 type Maestro struct {
 	GenesisTime    time.Time
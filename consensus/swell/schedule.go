@@ -0,0 +1,98 @@
+package swell
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+	"sort"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// Schedule is the public leader schedule. The leader of each clock is drawn
+// with probability proportional to stake: the hash of the election input of
+// the clock (see ElectionInput), whose seed changes every epoch, is mapped to
+// a point of [0, total stake) and the validator whose cumulative stake
+// interval holds it leads the clock. The seeds depend only on the genesis
+// unless the schedule takes them from a chain (see SeedFrom).
+//
+// Leaders are computed on demand, so a schedule takes memory proportional to
+// the number of validators regardless of their stakes or of the epoch length.
+type Schedule struct {
+	genesis    crypto.Hash
+	calendar   swell.Calendar
+	chain      *swell.BlockChain // source of the seed anchors, if any
+	tokens     []crypto.Token
+	cumulative []uint64 // cumulative[n] is the stake of validators 0 to n
+}
+
+// NewSchedule creates the schedule of validators with the epochs of calendar.
+// The order of validators does not matter.
+func NewSchedule(genesis crypto.Hash, calendar swell.Calendar, validators []swell.Validator) *Schedule {
+	sorted := make([]swell.Validator, 0, len(validators))
+	for _, validator := range validators {
+		if validator.Stake > 0 {
+			sorted = append(sorted, validator)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Token[:], sorted[j].Token[:]) < 0
+	})
+	schedule := &Schedule{
+		genesis:    genesis,
+		calendar:   calendar,
+		tokens:     make([]crypto.Token, len(sorted)),
+		cumulative: make([]uint64, len(sorted)),
+	}
+	total := uint64(0)
+	for n, validator := range sorted {
+		total += validator.Stake
+		schedule.tokens[n] = validator.Token
+		schedule.cumulative[n] = total
+	}
+	return schedule
+}
+
+// SeedFrom mixes the seed anchor of chain for every epoch (see
+// BlockChain.SeedAnchor) into the seed of the epoch.
+func (s *Schedule) SeedFrom(chain *swell.BlockChain) {
+	s.chain = chain
+}
+
+// Seed returns the election seed of the epoch of clock. It is false if the
+// chain of the schedule does not know the seed anchor of the epoch.
+func (s *Schedule) Seed(clock uint64) (crypto.Hash, bool) {
+	epoch := s.calendar.Epoch(clock)
+	if s.chain == nil {
+		return EpochSeed(s.genesis, epoch, crypto.ZeroHash), true
+	}
+	anchor, ok := s.chain.SeedAnchor(epoch)
+	return EpochSeed(s.genesis, epoch, anchor), ok
+}
+
+// Leader returns the token of the validator in charge of the block for clock,
+// or the zero token if no validator holds stake or the seed is not known.
+func (s *Schedule) Leader(clock uint64) crypto.Token {
+	return s.Proposer(clock, 0)
+}
+
+// Proposer returns the token of the validator in charge of proposing the
+// block for clock at round of a round based engine. The leader of clock
+// proposes at round 0 and every other validator follows in token order, so
+// that a silent leader is replaced regardless of stakes.
+func (s *Schedule) Proposer(clock uint64, round uint32) crypto.Token {
+	seed, ok := s.Seed(clock)
+	if len(s.tokens) == 0 || !ok {
+		return crypto.ZeroToken
+	}
+	return s.tokens[(s.leader(seed, clock)+int(round%uint32(len(s.tokens))))%len(s.tokens)]
+}
+
+func (s *Schedule) leader(seed crypto.Hash, clock uint64) int {
+	hash := crypto.Hasher(ElectionInput(seed, clock))
+	// the high word of random * total is uniform on [0, total) up to a bias
+	// of total / 2^64
+	point, _ := bits.Mul64(binary.LittleEndian.Uint64(hash[:8]), s.cumulative[len(s.cumulative)-1])
+	return sort.Search(len(s.cumulative), func(i int) bool { return s.cumulative[i] > point })
+}
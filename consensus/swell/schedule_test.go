@@ -0,0 +1,95 @@
+package swell
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// TestScheduleProportionalToStake runs a chi-squared goodness of fit test of
+// the leader frequencies against the stake distribution. Tokens are fixed so
+// that the test is deterministic.
+func TestScheduleProportionalToStake(t *testing.T) {
+	stakes := []uint64{1e15, 2e15, 3e15, 5e15, 9e15, 1e14}
+	validators := make([]swell.Validator, len(stakes))
+	index := make(map[crypto.Token]int)
+	total := uint64(0)
+	for n, stake := range stakes {
+		validators[n].Token = crypto.Token(crypto.Hasher([]byte{byte(n)}))
+		validators[n].Stake = stake
+		index[validators[n].Token] = n
+		total += stake
+	}
+	calendar := swell.NewCalendar(time.Time{}, 0, 50000)
+	schedule := NewSchedule(crypto.Hasher([]byte("genesis")), calendar, validators)
+	clocks := 3 * int(calendar.EpochSlots) / 2
+	counts := make([]int, len(stakes))
+	for clock := 0; clock < clocks; clock++ {
+		counts[index[schedule.Leader(uint64(clock))]] += 1
+	}
+	chi2 := 0.0
+	for n, count := range counts {
+		expected := float64(clocks) * float64(stakes[n]) / float64(total)
+		chi2 += (float64(count) - expected) * (float64(count) - expected) / expected
+	}
+	// critical value of the chi-squared distribution with 5 degrees of
+	// freedom at a significance of 0.001
+	if chi2 > 20.52 {
+		t.Errorf("leader frequencies %v not proportional to stakes: chi2 = %v", counts, chi2)
+	}
+
+	reordered := NewSchedule(crypto.Hasher([]byte("genesis")), calendar, append(validators[3:], validators[:3]...))
+	for clock := uint64(0); clock < 100; clock++ {
+		if reordered.Leader(clock) != schedule.Leader(clock) {
+			t.Fatal("schedule depends on the order of validators")
+		}
+	}
+	if NewSchedule(crypto.ZeroHash, calendar, nil).Leader(1) != crypto.ZeroToken {
+		t.Error("leader without validators")
+	}
+}
+
+// finalized returns a block of clock extending the block of checkpoint.
+func finalized(clock, checkpoint uint64, parent crypto.Hash) *swell.SignedBlock {
+	return &swell.SignedBlock{Block: &swell.Block{Clock: clock, Parent: parent, CheckPoint: checkpoint}}
+}
+
+func TestScheduleSeedAnchor(t *testing.T) {
+	validators := make([]swell.Validator, 10)
+	for n := range validators {
+		validators[n] = swell.Validator{Token: crypto.Token(crypto.Hasher([]byte{byte(n)})), Stake: 1}
+	}
+	genesis := crypto.Hasher([]byte("genesis"))
+	chain := &swell.BlockChain{GenesisHash: genesis, EpochSlots: 100}
+	first := finalized(50, 0, genesis)
+	chain.Finalize(first)
+	chain.Finalize(finalized(150, 50, first.Block.Hash()))
+	calendar := chain.Calendar()
+	epoch := calendar.FirstClock(2)
+	schedule, seeded := NewSchedule(genesis, calendar, validators), NewSchedule(genesis, calendar, validators)
+	seeded.SeedFrom(chain)
+	if seed, ok := seeded.Seed(epoch); !ok || seed != EpochSeed(genesis, 2, first.Block.Hash()) {
+		t.Fatal("seed not anchored to the last block finalized before the previous epoch")
+	}
+	changed := 0
+	for clock := uint64(0); clock < 100; clock++ {
+		if schedule.Leader(clock) != seeded.Leader(clock) || schedule.Leader(100+clock) != seeded.Leader(100+clock) {
+			t.Fatal("anchor changed the leaders of the first two epochs")
+		}
+		if schedule.Leader(epoch+clock) != seeded.Leader(epoch+clock) {
+			changed += 1
+		}
+	}
+	if changed < 50 {
+		t.Fatalf("anchor changed %v of 100 leaders of the epoch", changed)
+	}
+	// a chain restored past the boundary does not know the anchor
+	restored := &swell.BlockChain{GenesisHash: genesis, EpochSlots: 100}
+	restored.Finalize(finalized(150, 120, crypto.ZeroHash))
+	seeded.SeedFrom(restored)
+	if seeded.Leader(epoch) != crypto.ZeroToken {
+		t.Fatal("leader without a known seed")
+	}
+}
@@ -0,0 +1,354 @@
+// Package tendermint implements a round based BFT consensus engine in the
+// style of Tendermint.
+package tendermint
+
+import (
+	"time"
+
+	"github.com/lienkolabs/swell"
+	slots "github.com/lienkolabs/swell/consensus/swell"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// Timeouts of the steps of a round. The timeout of a step at round r is its
+// base timeout plus r times Delta, so that rounds eventually last long enough
+// for a correct proposer to be heard.
+type Timeouts struct {
+	Propose   time.Duration
+	Prevote   time.Duration
+	Precommit time.Duration
+	Delta     time.Duration
+}
+
+// SlotTimeouts returns timeouts proportional to the slot duration of the
+// chain calendar: a slot to propose and half a slot for the other steps.
+func SlotTimeouts(slot time.Duration) Timeouts {
+	return Timeouts{Propose: slot, Prevote: slot / 2, Precommit: slot / 2, Delta: slot / 2}
+}
+
+var DefaultTimeouts = SlotTimeouts(swell.DefaultSlotDuration)
+
+func (t Timeouts) duration(step byte, round uint32) time.Duration {
+	base := t.Propose
+	if step == prevote {
+		base = t.Prevote
+	} else if step == precommit {
+		base = t.Precommit
+	}
+	return base + time.Duration(round)*t.Delta
+}
+
+// buildFraction is the fraction of the propose timeout the proposer spends
+// pulling events from the pool.
+const buildFraction = 4
+
+// maxFuture is the maximum number of messages for the next clock kept until
+// the current one is decided. Only messages signed by validators are kept.
+const maxFuture = 1024
+
+// maxRoundJump is the maximum number of rounds ahead of the current round for
+// which messages are kept, so that a faulty validator cannot make the node
+// track rounds without bound.
+const maxRoundJump = 16
+
+type expiry struct {
+	clock uint64
+	round uint32
+	step  byte
+}
+
+// Engine decides the block of each clock, one clock after the other, in
+// rounds of three steps. The proposer of the round, the slot leader of the
+// clock at round 0 and the following validators at later rounds (see
+// slots.Schedule.Proposer), proposes a block. Validators prevote for it if it
+// is valid and they are not locked on another block, and precommit for it
+// once it has prevotes of more than two thirds of the stake, locking on it.
+// A block with precommits of more than two thirds of the stake in any round
+// is final. Steps that do not gather a quorum in time end with votes for no
+// block and the round moves on.
+//
+// All the state is owned by a single goroutine.
+type Engine struct {
+	chain    *swell.BlockChain
+	key      crypto.PrivateKey
+	token    crypto.Token
+	comm     *swell.Communication
+	pool     *swell.EventsPool
+	timeouts Timeouts
+	time     swell.TimeSource
+	expired  chan expiry
+	schedule *slots.Schedule
+	set      *swell.ValidatorSet // validators of clock
+	sync     *swell.SyncServer
+	detector *swell.EquivocationDetector // evidence received
+	err      error                       // error that stopped the engine
+	// state of the consensus of clock
+	clock       uint64
+	round       uint32
+	step        byte
+	rounds      map[uint32]*round
+	locked      crypto.Hash
+	lockedRound int32
+	valid       *swell.Block
+	validRound  int32
+	blocks      map[crypto.Hash]*swell.Block
+	overlays    map[crypto.Hash]swell.Overlay
+	rejected    map[crypto.Hash]struct{}
+	built       chan swell.BlockBuild
+	building    swell.Overlay
+	// messages for the next clock
+	futureProposals []*swell.Proposal
+	futureVotes     []*swell.Vote
+}
+
+// NewEngine is a swell.ConsensusEngine with the SlotTimeouts of the chain
+// calendar.
+func NewEngine(chain *swell.BlockChain, key crypto.PrivateKey) *swell.Communication {
+	return NewEngineWithTimeouts(SlotTimeouts(chain.Calendar().SlotDuration))(chain, key)
+}
+
+// NewEngineWithTimeouts returns a swell.ConsensusEngine with the given
+// timeouts.
+func NewEngineWithTimeouts(timeouts Timeouts) swell.ConsensusEngine {
+	return func(chain *swell.BlockChain, key crypto.PrivateKey) *swell.Communication {
+		engine := &Engine{
+			chain:    chain,
+			key:      key,
+			token:    key.PublicKey(),
+			comm:     swell.NewCommunication(),
+			pool:     swell.NewInstructionPool(),
+			timeouts: timeouts,
+			time:     chain.TimeSource(),
+			expired:  make(chan expiry),
+			sync:     swell.NewSyncServer(chain),
+			detector: swell.NewEquivocationDetector(),
+		}
+		engine.newClock()
+		go engine.run()
+		return engine.comm
+	}
+}
+
+func (e *Engine) run() {
+	e.progress()
+	for e.err == nil {
+		select {
+		case build := <-e.built:
+			e.built = nil
+			block := build()
+			e.proposeBuilt(block)
+		case proposal := <-e.comm.IncomingProposal:
+			if proposal != nil && proposal.Block != nil {
+				e.addProposal(proposal)
+			}
+		case vote := <-e.comm.IncomingVote:
+			if vote != nil {
+				e.addVote(vote)
+			}
+		case expired := <-e.expired:
+			if expired.clock == e.clock && expired.round == e.round {
+				e.timeout(expired.step)
+			}
+		case event := <-e.comm.Events:
+			if e.chain.CurrentState.Validate(event) {
+				e.pool.Queue(event, event.Hash())
+			}
+		case peer := <-e.comm.PeerRequest:
+			peer.Response <- e.chain.IsValidator(peer.Token)
+		case validate := <-e.comm.ValidateConn:
+			validate.Ok <- e.chain.IsValidator(validate.Token)
+		case evidence := <-e.comm.IncomingEvidence:
+			if evidence != nil && e.chain.VerifyEvidence(evidence) && e.detector.Add(evidence) {
+				if penalizer, ok := e.chain.CurrentState.(swell.Penalizer); ok {
+					penalizer.Penalize(evidence)
+				}
+			}
+		case sync := <-e.comm.Synchronization:
+			sync.Response <- e.sync.Serve(sync)
+		}
+		e.progress()
+	}
+	e.comm.Close()
+	e.comm.Halted <- e.err
+}
+
+// newClock starts the consensus of the clock after the tip.
+func (e *Engine) newClock() {
+	_, tip := e.chain.Tip()
+	e.clock = tip + 1
+	set := e.chain.ValidatorSet(e.clock)
+	if e.schedule == nil || (e.chain.Registry != nil && set != e.set) {
+		e.schedule = slots.NewSchedule(e.chain.GenesisHash, e.chain.Calendar(), set.Validators)
+	}
+	e.set = set
+	e.rounds = make(map[uint32]*round)
+	e.locked, e.lockedRound = crypto.ZeroValueHash, -1
+	e.valid, e.validRound = nil, -1
+	e.blocks = make(map[crypto.Hash]*swell.Block)
+	e.overlays = make(map[crypto.Hash]swell.Overlay)
+	e.rejected = make(map[crypto.Hash]struct{})
+	e.startRound(0)
+	proposals, votes := e.futureProposals, e.futureVotes
+	e.futureProposals, e.futureVotes = nil, nil
+	for _, proposal := range proposals {
+		e.addProposal(proposal)
+	}
+	for _, vote := range votes {
+		e.addVote(vote)
+	}
+}
+
+// wait schedules the timeout of step of the current round.
+func (e *Engine) wait(step byte) {
+	expired := expiry{clock: e.clock, round: e.round, step: step}
+	e.time.AfterFunc(e.timeouts.duration(step, e.round), func() { e.expired <- expired })
+}
+
+// proposeBuilt signs and proposes the block built by the node if it is still
+// the proposer. Otherwise the block is discarded and its events returned to
+// the pool.
+func (e *Engine) proposeBuilt(block *swell.Block) {
+	proposer := e.schedule.Proposer(e.clock, e.round) == e.token
+	if block.Clock == e.clock && e.step == propose && e.valid == nil && proposer {
+		block.Sign(e.key)
+		e.overlays[block.Hash()] = e.building
+		e.propose(block)
+		return
+	}
+	e.chain.CurrentState.Rollback(e.building)
+	for _, event := range block.Events {
+		e.pool.Queue(event, event.Hash())
+	}
+	if e.step == propose && proposer {
+		e.startRound(e.round)
+	}
+}
+
+func (e *Engine) propose(block *swell.Block) {
+	proposal := swell.NewProposal(e.round, e.validRound, block, nil, e.key)
+	e.comm.Proposal <- proposal
+	e.addProposal(proposal)
+}
+
+// addProposal keeps the first proposal of a round signed by its proposer
+// whose block is signed by a proposer of the clock (see publishedByProposer).
+func (e *Engine) addProposal(proposal *swell.Proposal) {
+	if proposal.Block.Clock == e.clock+1 && len(e.futureProposals) < maxFuture && e.future(proposal.Token) && proposal.Verify() {
+		e.futureProposals = append(e.futureProposals, proposal)
+	}
+	if proposal.Block.Clock != e.clock || proposal.Round > e.round+maxRoundJump || proposal.Token != e.schedule.Proposer(e.clock, proposal.Round) {
+		return
+	}
+	r := e.roundOf(proposal.Round)
+	if r.proposal != nil || !proposal.Verify() || !proposal.Block.Verify() || !e.publishedByProposer(proposal) {
+		return
+	}
+	r.proposal = proposal
+	e.blocks[proposal.Block.Hash()] = proposal.Block
+	r.sender(proposal.Token, e.set.Stake(proposal.Token))
+}
+
+// publishedByProposer checks that a new block is published by the proposer
+// of the proposal and a block proposed again by the proposer of a round up to
+// its valid round, where it was proposed new.
+func (e *Engine) publishedByProposer(proposal *swell.Proposal) bool {
+	if proposal.ValidRound < 0 {
+		return proposal.Block.Publisher == proposal.Token
+	}
+	// proposers repeat every len(e.set.Validators) rounds at most
+	for round := uint32(0); round <= uint32(proposal.ValidRound) && int(round) < len(e.set.Validators); round++ {
+		if e.schedule.Proposer(e.clock, round) == proposal.Block.Publisher {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) addVote(vote *swell.Vote) {
+	if vote.Clock == e.clock+1 && len(e.futureVotes) < maxFuture && e.future(vote.Token) && vote.Verify() {
+		e.futureVotes = append(e.futureVotes, vote)
+	}
+	if vote.Clock != e.clock || vote.Round > e.round+maxRoundJump {
+		return
+	}
+	if stake := e.set.Stake(vote.Token); stake > 0 && vote.Verify() {
+		e.count(vote, stake)
+	}
+}
+
+// future checks if token is a validator of the next clock as far as known
+// before the current one is decided.
+func (e *Engine) future(token crypto.Token) bool {
+	return e.chain.ValidatorSet(e.clock+1).Stake(token) > 0
+}
+
+func (e *Engine) count(vote *swell.Vote, stake uint64) {
+	r := e.roundOf(vote.Round)
+	votes := r.prevotes
+	if vote.Kind == swell.Precommit {
+		votes = r.precommits
+	}
+	if votes.add(vote, stake) {
+		r.sender(vote.Token, stake)
+	}
+}
+
+// vote publishes the vote of the node, if it is a validator, for hash at step
+// kind of the current round.
+func (e *Engine) vote(kind byte, hash crypto.Hash) {
+	stake := e.set.Stake(e.token)
+	if stake == 0 {
+		return
+	}
+	vote := swell.NewVote(kind, e.clock, e.round, hash, e.key)
+	e.comm.Vote <- vote
+	e.count(vote, stake)
+}
+
+// isValid checks, once per block, that block extends the tip, was published
+// by a validator and that its events are accepted by the state.
+func (e *Engine) isValid(block *swell.Block) bool {
+	hash := block.Hash()
+	if _, ok := e.overlays[hash]; ok {
+		return true
+	}
+	if _, ok := e.rejected[hash]; ok {
+		return false
+	}
+	parent, tip := e.chain.Tip()
+	var overlay swell.Overlay
+	if block.Clock == e.clock && block.Parent == parent && block.CheckPoint == tip && e.set.Stake(block.Publisher) > 0 {
+		overlay = swell.ValidateBlock(e.chain.CurrentState, nil, block, e.chain.Params)
+	}
+	if overlay == nil {
+		e.rejected[hash] = struct{}{}
+		return false
+	}
+	e.overlays[hash] = overlay
+	return true
+}
+
+// finalize commits block, signed by the commit signatures of its precommits
+// at round, and starts the next clock. If the block cannot be committed the
+// engine stops.
+func (e *Engine) finalize(block *swell.Block, round uint32, commits []swell.Signature) {
+	hash := block.Hash()
+	signed := e.chain.AppendCandidate(block)
+	signed.Round, signed.Signatures = round, commits
+	if e.err = e.chain.Commit(signed, e.overlays[hash]); e.err != nil {
+		return
+	}
+	delete(e.overlays, hash)
+	for _, overlay := range e.overlays {
+		e.chain.CurrentState.Rollback(overlay)
+	}
+	e.pool.DeleteEvents(block.Events)
+	if block.Clock > swell.EvidenceWindow {
+		e.detector.Prune(block.Clock - swell.EvidenceWindow)
+	}
+	e.comm.Checkpoint <- signed
+	if change := e.chain.SetChange(block.Clock, e.key); change != nil {
+		e.comm.SetChange <- change
+	}
+	e.newClock()
+}
@@ -0,0 +1,202 @@
+package tendermint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell"
+	slots "github.com/lienkolabs/swell/consensus/swell"
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/simulation"
+)
+
+var testTimeouts = Timeouts{
+	Propose:   200 * time.Millisecond,
+	Prevote:   100 * time.Millisecond,
+	Precommit: 100 * time.Millisecond,
+	Delta:     100 * time.Millisecond,
+}
+
+// testNetwork starts an engine for each of the first running keys and
+// connects them. Every validator holds the same stake.
+func testNetwork(keys []crypto.PrivateKey, running int) ([]*swell.Communication, *swell.BlockChain) {
+	validators := make([]swell.Validator, len(keys))
+	for n, key := range keys {
+		validators[n] = swell.Validator{Token: key.PublicKey(), Stake: 10}
+	}
+	newChain := func() *swell.BlockChain {
+		return &swell.BlockChain{
+			GenesisHash:  crypto.Hasher([]byte("tendermint")),
+			GenesisTime:  time.Now(),
+			TotalStake:   10 * uint64(len(keys)),
+			Validators:   validators,
+			CurrentState: &simulation.State{},
+		}
+	}
+	comms := make([]*swell.Communication, running)
+	for n := range comms {
+		comms[n] = swell.LauchNewGenesisConsensus(NewEngineWithTimeouts(testTimeouts), newChain(), keys[n])
+	}
+	for n := range comms {
+		go func(from int) {
+			for {
+				select {
+				case proposal := <-comms[from].Proposal:
+					for to, comm := range comms {
+						if to != from {
+							go func(comm *swell.Communication) { comm.IncomingProposal <- proposal }(comm)
+						}
+					}
+				case vote := <-comms[from].Vote:
+					for to, comm := range comms {
+						if to != from {
+							go func(comm *swell.Communication) { comm.IncomingVote <- vote }(comm)
+						}
+					}
+				}
+			}
+		}(n)
+	}
+	return comms, newChain()
+}
+
+func testKeys(count int) []crypto.PrivateKey {
+	keys := make([]crypto.PrivateKey, count)
+	for n := range keys {
+		_, keys[n] = crypto.RandomAsymetricKey()
+	}
+	return keys
+}
+
+// finalized collects the blocks finalized by every node up to clock.
+func finalized(t *testing.T, comms []*swell.Communication, clock uint64) [][]*swell.SignedBlock {
+	blocks := make([][]*swell.SignedBlock, len(comms))
+	timeout := time.After(20 * time.Second)
+	for n, comm := range comms {
+		for uint64(len(blocks[n])) < clock {
+			select {
+			case signed := <-comm.Checkpoint:
+				blocks[n] = append(blocks[n], signed)
+			case <-timeout:
+				t.Fatalf("node %v finalized %v blocks", n, len(blocks[n]))
+			}
+		}
+	}
+	return blocks
+}
+
+func TestFinalizesEvents(t *testing.T) {
+	comms, chain := testNetwork(testKeys(4), 4)
+	event := simulation.NewEvent(1)
+	for _, comm := range comms {
+		comm.Events <- event
+	}
+	blocks := finalized(t, comms, 3)
+	included := false
+	for clock := range blocks[0] {
+		signed := blocks[0][clock]
+		if signed.Block.Clock != uint64(clock+1) || !chain.VerifyQuorum(signed) {
+			t.Fatalf("invalid finalized block for clock %v", clock+1)
+		}
+		for n := range comms {
+			if blocks[n][clock].Block.Hash() != signed.Block.Hash() {
+				t.Fatalf("nodes finalized different blocks for clock %v", clock+1)
+			}
+		}
+		for _, finalized := range signed.Block.Events {
+			included = included || finalized.Hash() == event.Hash()
+		}
+	}
+	if !included {
+		t.Fatal("event was not finalized")
+	}
+}
+
+func TestRotationPastSilentLeader(t *testing.T) {
+	keys := testKeys(4)
+	comms, chain := testNetwork(keys, 3)
+	schedule := slots.NewSchedule(chain.GenesisHash, chain.Calendar(), chain.Validators)
+	// the clocks up to the first led by the silent validator
+	clock := uint64(1)
+	for schedule.Leader(clock) != keys[3].PublicKey() {
+		clock += 1
+	}
+	blocks := finalized(t, comms, clock)
+	for n := range comms {
+		signed := blocks[n][clock-1]
+		if signed.Block.Publisher == keys[3].PublicKey() || !chain.VerifyQuorum(signed) {
+			t.Fatal("invalid block past silent leader")
+		}
+		if signed.Block.Hash() != blocks[0][clock-1].Block.Hash() {
+			t.Fatal("nodes finalized different blocks past silent leader")
+		}
+	}
+}
+
+func TestProposalOfBlockByAnotherPublisher(t *testing.T) {
+	keys := testKeys(4)
+	validators := make([]swell.Validator, len(keys))
+	for n, key := range keys {
+		validators[n] = swell.Validator{Token: key.PublicKey(), Stake: 10}
+	}
+	schedule := slots.NewSchedule(crypto.Hasher([]byte("tendermint")), swell.NewCalendar(time.Now(), 0, 0), validators)
+	// the leader of clock 1 is silent but for a proposal of a block published
+	// by another validator
+	for n, key := range keys {
+		if key.PublicKey() == schedule.Leader(1) {
+			keys[n], keys[3] = keys[3], keys[n]
+		}
+	}
+	comms, chain := testNetwork(keys, 3)
+	block := &swell.Block{Clock: 1, Parent: chain.GenesisHash, Publisher: keys[0].PublicKey(), PublishedAt: time.Now()}
+	block.Sign(keys[0])
+	proposal := swell.NewProposal(0, -1, block, nil, keys[3])
+	for _, comm := range comms {
+		comm.IncomingProposal <- proposal
+	}
+	blocks := finalized(t, comms, 1)
+	for n := range comms {
+		if signed := blocks[n][0]; signed.Block.Hash() == block.Hash() || signed.Round == 0 || !chain.VerifyQuorum(signed) {
+			t.Fatal("block not published by its proposer finalized")
+		}
+	}
+}
+
+func TestFutureAndFarMessages(t *testing.T) {
+	keys := testKeys(4)
+	_, chain := testNetwork(keys, 0)
+	_, outsider := crypto.RandomAsymetricKey()
+	e := &Engine{
+		chain:    chain,
+		key:      outsider,
+		token:    outsider.PublicKey(),
+		comm:     swell.NewCommunication(),
+		pool:     swell.NewInstructionPool(),
+		timeouts: testTimeouts,
+		time:     chain.TimeSource(),
+		expired:  make(chan expiry, 16),
+		detector: swell.NewEquivocationDetector(),
+	}
+	e.newClock()
+	// messages of the next clock are kept only if signed by a validator
+	e.addVote(swell.NewVote(swell.Prevote, 2, 0, crypto.ZeroValueHash, outsider))
+	forged := swell.NewVote(swell.Prevote, 2, 0, crypto.ZeroValueHash, keys[0])
+	forged.Round = 1
+	e.addVote(forged)
+	if len(e.futureVotes) != 0 {
+		t.Fatal("unverified vote of the next clock kept")
+	}
+	e.addVote(swell.NewVote(swell.Prevote, 2, 0, crypto.ZeroValueHash, keys[0]))
+	if len(e.futureVotes) != 1 {
+		t.Fatal("vote of the next clock not kept")
+	}
+	// rounds too far ahead are not tracked
+	e.addVote(swell.NewVote(swell.Prevote, 1, maxRoundJump+1, crypto.ZeroValueHash, keys[0]))
+	if _, ok := e.rounds[maxRoundJump+1]; ok {
+		t.Fatal("round beyond the maximum jump tracked")
+	}
+	e.addVote(swell.NewVote(swell.Prevote, 1, maxRoundJump, crypto.ZeroValueHash, keys[0]))
+	if _, ok := e.rounds[maxRoundJump]; !ok {
+		t.Fatal("round within the maximum jump not tracked")
+	}
+}
@@ -0,0 +1,239 @@
+package tendermint
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// Steps of a round.
+const (
+	propose byte = iota
+	prevote
+	precommit
+)
+
+// voteSet tallies the votes of one step of a round. Only the first vote of
+// each validator counts.
+type voteSet struct {
+	votes map[crypto.Token]*swell.Vote
+	stake map[crypto.Hash]uint64 // stake voting for each hash
+	total uint64                 // stake of every vote
+}
+
+func newVoteSet() *voteSet {
+	return &voteSet{votes: make(map[crypto.Token]*swell.Vote), stake: make(map[crypto.Hash]uint64)}
+}
+
+func (v *voteSet) add(vote *swell.Vote, stake uint64) bool {
+	if _, ok := v.votes[vote.Token]; ok {
+		return false
+	}
+	v.votes[vote.Token] = vote
+	v.stake[vote.Hash] += stake
+	v.total += stake
+	return true
+}
+
+// commits returns the commit signatures of the precommits for hash in token
+// order.
+func (v *voteSet) commits(hash crypto.Hash) []swell.Signature {
+	signatures := make([]swell.Signature, 0)
+	for _, vote := range v.votes {
+		if vote.Hash == hash {
+			signatures = append(signatures, vote.CommitSignature())
+		}
+	}
+	sort.Slice(signatures, func(i, j int) bool {
+		return bytes.Compare(signatures[i].Token[:], signatures[j].Token[:]) < 0
+	})
+	return signatures
+}
+
+// round holds the messages received for a round of the current clock.
+type round struct {
+	proposal   *swell.Proposal
+	prevotes   *voteSet
+	precommits *voteSet
+	senders    map[crypto.Token]struct{}
+	stake      uint64 // stake of the senders of any message of the round
+	// conditions of the state machine that trigger only once per round
+	polka         bool
+	prevoteWait   bool
+	precommitWait bool
+}
+
+func newRound() *round {
+	return &round{prevotes: newVoteSet(), precommits: newVoteSet(), senders: make(map[crypto.Token]struct{})}
+}
+
+func (r *round) sender(token crypto.Token, stake uint64) {
+	if _, ok := r.senders[token]; !ok {
+		r.senders[token] = struct{}{}
+		r.stake += stake
+	}
+}
+
+func (e *Engine) quorum(stake uint64) bool {
+	return 3*stake > 2*e.set.TotalStake
+}
+
+// oneHonest checks if stake holds at least one honest validator when less
+// than a third of the stake is byzantine.
+func (e *Engine) oneHonest(stake uint64) bool {
+	return 3*stake > e.set.TotalStake
+}
+
+// numbers returns the numbers of the rounds with messages in increasing
+// order, so that rules apply the same way on every run.
+func (e *Engine) numbers() []uint32 {
+	numbers := make([]uint32, 0, len(e.rounds))
+	for number := range e.rounds {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers
+}
+
+func (e *Engine) roundOf(number uint32) *round {
+	r, ok := e.rounds[number]
+	if !ok {
+		r = newRound()
+		e.rounds[number] = r
+	}
+	return r
+}
+
+// progress applies the rules of the state machine until none applies or the
+// engine stops.
+func (e *Engine) progress() {
+	for e.err == nil && e.advance() {
+	}
+}
+
+// advance applies the first rule whose condition holds and reports whether
+// any did.
+func (e *Engine) advance() bool {
+	if e.decide() {
+		return true
+	}
+	// a third of the stake is already past the current round, the first such
+	// round is joined
+	for _, number := range e.numbers() {
+		if number > e.round && e.oneHonest(e.rounds[number].stake) {
+			e.startRound(number)
+			return true
+		}
+	}
+	current := e.roundOf(e.round)
+	proposal := current.proposal
+	if e.step == propose && proposal != nil {
+		hash := proposal.Block.Hash()
+		if proposal.ValidRound < 0 {
+			e.prevote(e.isValid(proposal.Block) && (e.lockedRound < 0 || e.locked == hash), hash)
+			return true
+		}
+		if valid := uint32(proposal.ValidRound); valid < e.round && e.quorum(e.roundOf(valid).prevotes.stake[hash]) {
+			e.prevote(e.isValid(proposal.Block) && (e.lockedRound <= proposal.ValidRound || e.locked == hash), hash)
+			return true
+		}
+	}
+	if e.step == prevote && !current.prevoteWait && e.quorum(current.prevotes.total) {
+		current.prevoteWait = true
+		e.wait(prevote)
+		return true
+	}
+	if e.step >= prevote && !current.polka && proposal != nil {
+		hash := proposal.Block.Hash()
+		if e.quorum(current.prevotes.stake[hash]) && e.isValid(proposal.Block) {
+			current.polka = true
+			if e.step == prevote {
+				e.locked, e.lockedRound = hash, int32(e.round)
+				e.vote(swell.Precommit, hash)
+				e.step = precommit
+			}
+			e.valid, e.validRound = proposal.Block, int32(e.round)
+			return true
+		}
+	}
+	if e.step == prevote && e.quorum(current.prevotes.stake[crypto.ZeroValueHash]) {
+		e.vote(swell.Precommit, crypto.ZeroValueHash)
+		e.step = precommit
+		return true
+	}
+	if !current.precommitWait && e.quorum(current.precommits.total) {
+		current.precommitWait = true
+		e.wait(precommit)
+		return true
+	}
+	return false
+}
+
+// decide finalizes a block with precommits of more than two thirds of the
+// stake in any round.
+func (e *Engine) decide() bool {
+	for _, number := range e.numbers() {
+		r := e.rounds[number]
+		for hash, stake := range r.precommits.stake {
+			if hash == crypto.ZeroValueHash || !e.quorum(stake) {
+				continue
+			}
+			if block, ok := e.blocks[hash]; ok && e.isValid(block) {
+				e.finalize(block, number, r.precommits.commits(hash))
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// prevote votes for hash if ok or for no block otherwise.
+func (e *Engine) prevote(ok bool, hash crypto.Hash) {
+	if !ok {
+		hash = crypto.ZeroValueHash
+	}
+	e.vote(swell.Prevote, hash)
+	e.step = prevote
+}
+
+// startRound moves to round. The proposer of the round proposes the block it
+// saw with a quorum of prevotes, if any, or builds a new one. Every other
+// validator waits for the proposal until the propose timeout.
+func (e *Engine) startRound(number uint32) {
+	e.round, e.step = number, propose
+	if e.schedule.Proposer(e.clock, number) != e.token {
+		e.wait(propose)
+		return
+	}
+	if e.valid != nil {
+		e.propose(e.valid)
+		return
+	}
+	if e.built != nil {
+		// the block being built is proposed once ready
+		return
+	}
+	parent, checkpoint := e.chain.Tip()
+	finish := e.time.Now().Add(e.timeouts.Propose / buildFraction)
+	e.building = e.chain.CurrentState.Overlay(nil, e.clock)
+	e.built = swell.BlockBuilder(parent, checkpoint, e.clock, e.token, finish, e.pool, e.building, e.chain.Params, e.time)
+}
+
+// timeout applies the timeout of step of the current round.
+func (e *Engine) timeout(step byte) {
+	switch step {
+	case propose:
+		if e.step == propose {
+			e.prevote(false, crypto.ZeroValueHash)
+		}
+	case prevote:
+		if e.step == prevote {
+			e.vote(swell.Precommit, crypto.ZeroValueHash)
+			e.step = precommit
+		}
+	case precommit:
+		e.startRound(e.round + 1)
+	}
+}
@@ -0,0 +1,112 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+
+	"github.com/lienkolabs/swell/crypto/edwards25519"
+)
+
+// BatchVerifier verifies many ed25519 signatures at once. For signatures
+// (R_i, S_i) by A_i with challenge k_i and random 128-bit coefficients z_i it
+// checks the cofactored equation
+//
+//	[8]((sum z_i S_i) B - sum z_i R_i - sum (z_i k_i) A_i) = 0
+//
+// with a single multi-scalar multiplication, about twice as fast as verifying
+// the signatures one by one. If the batch fails every signature is verified
+// on its own with Token.VerifyZIP215 to find the bad ones. A batch accepts
+// exactly the signatures accepted by Token.VerifyZIP215.
+type BatchVerifier struct {
+	entries []batchEntry
+}
+
+type batchEntry struct {
+	token     Token
+	msg       []byte
+	signature Signature
+}
+
+func NewBatchVerifier() *BatchVerifier {
+	return &BatchVerifier{entries: make([]batchEntry, 0)}
+}
+
+// Add queues the signature of msg by token for verification.
+func (b *BatchVerifier) Add(token Token, msg []byte, signature Signature) {
+	b.entries = append(b.entries, batchEntry{token: token, msg: msg, signature: signature})
+}
+
+func (b *BatchVerifier) Len() int {
+	return len(b.entries)
+}
+
+// Verify returns true if every queued signature is valid. Otherwise valid
+// reports which of them, in the order they were added, are.
+func (b *BatchVerifier) Verify() (ok bool, valid []bool) {
+	if len(b.entries) > 1 && b.verifyBatch() {
+		valid = make([]bool, len(b.entries))
+		for n := range valid {
+			valid[n] = true
+		}
+		return true, valid
+	}
+	ok = true
+	valid = make([]bool, len(b.entries))
+	for n, entry := range b.entries {
+		valid[n] = entry.token.VerifyZIP215(entry.msg, entry.signature)
+		ok = ok && valid[n]
+	}
+	return ok, valid
+}
+
+func (b *BatchVerifier) verifyBatch() bool {
+	count := len(b.entries)
+	random := make([]byte, 16*count)
+	if _, err := rand.Read(random); err != nil {
+		return false
+	}
+	scalars := make([]*[32]byte, 2*count)
+	points := make([]*edwards25519.ExtendedGroupElement, 2*count)
+	var sum, zero [32]byte
+	h := sha512.New()
+	for n, entry := range b.entries {
+		var s, z [32]byte
+		copy(s[:], entry.signature[32:])
+		if !edwards25519.ScMinimal(&s) {
+			return false
+		}
+		var A, R edwards25519.ExtendedGroupElement
+		publicKey := [32]byte(entry.token)
+		if !A.FromBytes(&publicKey) {
+			return false
+		}
+		var encodedR [32]byte
+		copy(encodedR[:], entry.signature[:32])
+		if !R.FromBytes(&encodedR) {
+			return false
+		}
+		edwards25519.FeNeg(&A.X, &A.X)
+		edwards25519.FeNeg(&A.T, &A.T)
+		edwards25519.FeNeg(&R.X, &R.X)
+		edwards25519.FeNeg(&R.T, &R.T)
+
+		h.Reset()
+		h.Write(encodedR[:])
+		h.Write(publicKey[:])
+		h.Write(entry.msg)
+		var digest [64]byte
+		h.Sum(digest[:0])
+		var k, zk [32]byte
+		edwards25519.ScReduce(&k, &digest)
+
+		copy(z[:16], random[16*n:16*(n+1)])
+		edwards25519.ScMulAdd(&sum, &z, &s, &sum)
+		edwards25519.ScMulAdd(&zk, &z, &k, &zero)
+		scalars[2*n], points[2*n] = &z, &R
+		scalars[2*n+1], points[2*n+1] = &zk, &A
+	}
+	var check, cofactored edwards25519.ProjectiveGroupElement
+	edwards25519.GeMultiScalarMultVartime(&check, &sum, scalars, points)
+	check.MulByCofactor(&cofactored)
+	return cofactored.IsIdentity()
+}
@@ -0,0 +1,70 @@
+package crypto
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newBatch(count int) *BatchVerifier {
+	batch := NewBatchVerifier()
+	for n := 0; n < count; n++ {
+		token, key := RandomAsymetricKey()
+		msg := []byte(fmt.Sprintf("message %v", n))
+		batch.Add(token, msg, key.Sign(msg))
+	}
+	return batch
+}
+
+func TestBatchVerify(t *testing.T) {
+	for _, count := range []int{1, 2, 3, 64} {
+		batch := newBatch(count)
+		if count > 1 && !batch.verifyBatch() {
+			t.Fatalf("valid batch of %v rejected by the multi-scalar check", count)
+		}
+		if ok, valid := batch.Verify(); !ok || len(valid) != count {
+			t.Fatalf("valid batch of %v rejected", count)
+		}
+	}
+	batch := newBatch(16)
+	batch.entries[3].msg = []byte("tampered")
+	batch.entries[11].signature[40] ^= 1
+	if batch.verifyBatch() {
+		t.Fatal("batch with invalid signatures accepted")
+	}
+	ok, valid := batch.Verify()
+	if ok {
+		t.Fatal("batch with invalid signatures accepted")
+	}
+	for n, v := range valid {
+		if v == (n == 3 || n == 11) {
+			t.Errorf("wrong validity for signature %v", n)
+		}
+	}
+}
+
+func benchmarkBatch(b *testing.B, count int) {
+	batch := newBatch(count)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if ok, _ := batch.Verify(); !ok {
+			b.Fatal("valid batch rejected")
+		}
+	}
+}
+
+func benchmarkSequential(b *testing.B, count int) {
+	batch := newBatch(count)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, entry := range batch.entries {
+			if !entry.token.Verify(entry.msg, entry.signature) {
+				b.Fatal("valid signature rejected")
+			}
+		}
+	}
+}
+
+func BenchmarkBatchVerify64(b *testing.B)        { benchmarkBatch(b, 64) }
+func BenchmarkBatchVerify1024(b *testing.B)      { benchmarkBatch(b, 1024) }
+func BenchmarkSequentialVerify64(b *testing.B)   { benchmarkSequential(b, 64) }
+func BenchmarkSequentialVerify1024(b *testing.B) { benchmarkSequential(b, 1024) }
@@ -31,7 +31,10 @@ func (s Signature) MarshalText() (text []byte, err error) {
 	return
 }
 
-func (s Signature) UnmarshalText(text []byte) error {
+func (s *Signature) UnmarshalText(text []byte) error {
+	if len(text) != 2*SignatureSize {
+		return errInvalidTextLength
+	}
 	_, err := hex.Decode(s[:], text)
 	return err
 }
@@ -152,7 +155,10 @@ func (t Token) String() string {
 	return string(text)
 }
 
-func (t Token) UnmarshalText(text []byte) error {
+func (t *Token) UnmarshalText(text []byte) error {
+	if len(text) != 2*TokenSize {
+		return errInvalidTextLength
+	}
 	_, err := hex.Decode(t[:], text)
 	return err
 }
@@ -221,3 +227,57 @@ func (t Token) Verify(msg []byte, signature Signature) bool {
 	return bytes.Equal(signature[:32], checkR[:])
 
 }
+
+var scalarOne = [32]byte{1}
+
+// VerifyZIP215 verifies signature under the rules of ZIP-215, which are
+// meant for consensus: every implementation following them agrees on every
+// signature, and they accept exactly the signatures accepted by a
+// BatchVerifier.
+//
+//   - S must be canonical, that is less than the group order.
+//   - A and R must decode to curve points, but their encodings need not be
+//     canonical: y may be greater than or equal to p and the sign bit may be
+//     set when x is zero.
+//   - The challenge k is the hash of the encodings of R and A as received.
+//   - The cofactored equation [8](S B - R - k A) = 0 must hold, so small order
+//     components of A and R are ignored.
+//
+// Verify, on the other hand, checks the cofactorless equation against the
+// canonical encoding of R and may reject signatures accepted by VerifyZIP215.
+func (t Token) VerifyZIP215(msg []byte, signature Signature) bool {
+	var s [32]byte
+	copy(s[:], signature[32:])
+	if !edwards25519.ScMinimal(&s) {
+		return false
+	}
+	var A, R edwards25519.ExtendedGroupElement
+	publicKey := [32]byte(t)
+	if !A.FromBytes(&publicKey) {
+		return false
+	}
+	var encodedR [32]byte
+	copy(encodedR[:], signature[:32])
+	if !R.FromBytes(&encodedR) {
+		return false
+	}
+	edwards25519.FeNeg(&A.X, &A.X)
+	edwards25519.FeNeg(&A.T, &A.T)
+	edwards25519.FeNeg(&R.X, &R.X)
+	edwards25519.FeNeg(&R.T, &R.T)
+
+	h := sha512.New()
+	h.Write(encodedR[:])
+	h.Write(publicKey[:])
+	h.Write(msg)
+	var digest [64]byte
+	h.Sum(digest[:0])
+	var k [32]byte
+	edwards25519.ScReduce(&k, &digest)
+
+	var check, cofactored edwards25519.ProjectiveGroupElement
+	one := scalarOne
+	edwards25519.GeMultiScalarMultVartime(&check, &s, []*[32]byte{&k, &one}, []*edwards25519.ExtendedGroupElement{&A, &R})
+	check.MulByCofactor(&cofactored)
+	return cofactored.IsIdentity()
+}
@@ -90,7 +90,7 @@ func TestGolden(t *testing.T) {
 			t.Errorf("different signature result on line %d: %x vs %x", lineNo, sig, sig2)
 		}
 
-		if !token.Verify(msg, sig2) {
+		if !token.Verify(msg, sig2) || !token.VerifyZIP215(msg, sig2) {
 			t.Errorf("signature failed to verify on line %d", lineNo)
 		}
 
@@ -131,7 +131,7 @@ func TestMalleability(t *testing.T) {
 		0xb1, 0x08, 0xc3, 0xbd, 0xae, 0x36, 0x9e, 0xf5, 0x49, 0xfa,
 	}
 
-	if publicKey.Verify(msg, sig) {
+	if publicKey.Verify(msg, sig) || publicKey.VerifyZIP215(msg, sig) {
 		t.Fatal("non-canonical signature accepted")
 	}
 }
@@ -0,0 +1,168 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edwards25519
+
+// GeMultiScalarMultVartime sets r = b*B + a[0]*A[0] + ... + a[n-1]*A[n-1]
+// where B is the Ed25519 base point. It uses Straus' method: the doublings
+// are shared among all the points and each scalar is recoded in a sliding
+// window, as in GeDoubleScalarMultVartime.
+func GeMultiScalarMultVartime(r *ProjectiveGroupElement, b *[32]byte, a []*[32]byte, A []*ExtendedGroupElement) {
+	var bSlide [256]int8
+	aSlide := make([][256]int8, len(a))
+	Ai := make([][8]CachedGroupElement, len(A)) // A,3A,5A,7A,9A,11A,13A,15A
+	var t CompletedGroupElement
+	var u, A2 ExtendedGroupElement
+	var i int
+
+	slide(&bSlide, b)
+	for n := range a {
+		slide(&aSlide[n], a[n])
+		A[n].ToCached(&Ai[n][0])
+		A[n].Double(&t)
+		t.ToExtended(&A2)
+		for i := 0; i < 7; i++ {
+			geAdd(&t, &A2, &Ai[n][i])
+			t.ToExtended(&u)
+			u.ToCached(&Ai[n][i+1])
+		}
+	}
+
+	r.Zero()
+
+	for i = 255; i >= 0; i-- {
+		nonZero := bSlide[i] != 0
+		for n := range aSlide {
+			nonZero = nonZero || aSlide[n][i] != 0
+		}
+		if nonZero {
+			break
+		}
+	}
+
+	for ; i >= 0; i-- {
+		r.Double(&t)
+
+		for n := range aSlide {
+			if aSlide[n][i] > 0 {
+				t.ToExtended(&u)
+				geAdd(&t, &u, &Ai[n][aSlide[n][i]/2])
+			} else if aSlide[n][i] < 0 {
+				t.ToExtended(&u)
+				geSub(&t, &u, &Ai[n][(-aSlide[n][i])/2])
+			}
+		}
+
+		if bSlide[i] > 0 {
+			t.ToExtended(&u)
+			geMixedAdd(&t, &u, &bi[bSlide[i]/2])
+		} else if bSlide[i] < 0 {
+			t.ToExtended(&u)
+			geMixedSub(&t, &u, &bi[(-bSlide[i])/2])
+		}
+
+		t.ToProjective(r)
+	}
+}
+
+// MulByCofactor sets r = 8*p.
+func (p *ProjectiveGroupElement) MulByCofactor(r *ProjectiveGroupElement) {
+	var t CompletedGroupElement
+	p.Double(&t)
+	t.ToProjective(r)
+	r.Double(&t)
+	t.ToProjective(r)
+	r.Double(&t)
+	t.ToProjective(r)
+}
+
+// IsIdentity returns true if p is the neutral element (0, 1).
+func (p *ProjectiveGroupElement) IsIdentity() bool {
+	var check FieldElement
+	FeSub(&check, &p.Y, &p.Z)
+	return FeIsNonZero(&p.X) == 0 && FeIsNonZero(&check) == 0
+}
+
+func (p *CachedGroupElement) Zero() {
+	FeOne(&p.yPlusX)
+	FeOne(&p.yMinusX)
+	FeOne(&p.Z)
+	FeZero(&p.T2d)
+}
+
+func CachedGroupElementCMove(t, u *CachedGroupElement, b int32) {
+	FeCMove(&t.yPlusX, &u.yPlusX, b)
+	FeCMove(&t.yMinusX, &u.yMinusX, b)
+	FeCMove(&t.Z, &u.Z, b)
+	FeCMove(&t.T2d, &u.T2d, b)
+}
+
+func selectCached(t *CachedGroupElement, table *[8]CachedGroupElement, b int32) {
+	var minusT CachedGroupElement
+	bNegative := negative(b)
+	bAbs := b - (((-bNegative) & b) << 1)
+
+	t.Zero()
+	for i := int32(0); i < 8; i++ {
+		CachedGroupElementCMove(t, &table[i], equal(bAbs, i+1))
+	}
+	FeCopy(&minusT.yPlusX, &t.yMinusX)
+	FeCopy(&minusT.yMinusX, &t.yPlusX)
+	FeCopy(&minusT.Z, &t.Z)
+	FeNeg(&minusT.T2d, &t.T2d)
+	CachedGroupElementCMove(t, &minusT, bNegative)
+}
+
+// GeScalarMult computes h = a*A in constant time with respect to a, so that
+// it can be used with secret scalars.
+//
+// Preconditions:
+//
+//	a[31] <= 127
+func GeScalarMult(h *ExtendedGroupElement, a *[32]byte, A *ExtendedGroupElement) {
+	var e [64]int8
+
+	for i, v := range a {
+		e[2*i] = int8(v & 15)
+		e[2*i+1] = int8((v >> 4) & 15)
+	}
+
+	carry := int8(0)
+	for i := 0; i < 63; i++ {
+		e[i] += carry
+		carry = (e[i] + 8) >> 4
+		e[i] -= carry << 4
+	}
+	e[63] += carry
+	// each e[i] is between -8 and 8.
+
+	var table [8]CachedGroupElement // A,2A,3A,...,8A
+	var r CompletedGroupElement
+	var u ExtendedGroupElement
+	A.ToCached(&table[0])
+	u = *A
+	for i := 1; i < 8; i++ {
+		geAdd(&r, &u, &table[0])
+		r.ToExtended(&u)
+		u.ToCached(&table[i])
+	}
+
+	h.Zero()
+	var s ProjectiveGroupElement
+	var t CachedGroupElement
+	for i := 63; i >= 0; i-- {
+		h.Double(&r)
+		r.ToProjective(&s)
+		s.Double(&r)
+		r.ToProjective(&s)
+		s.Double(&r)
+		r.ToProjective(&s)
+		s.Double(&r)
+		r.ToExtended(h)
+
+		selectCached(&t, &table, int32(e[i]))
+		geAdd(&r, h, &t)
+		r.ToExtended(h)
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 )
 
 type Hash [Size]byte
 
 var hashLength = base64.StdEncoding.EncodedLen(Size)
 
+var errInvalidTextLength = errors.New("invalid text length")
+
 func (h Hash) MarshalText() (text []byte, err error) {
 	text = make([]byte, hashLength)
 	base64.StdEncoding.Encode(text, h[:])
@@ -28,7 +31,10 @@ func EncodeHash(h Hash) string {
 	return string(text)
 }
 
-func (h Hash) UnmarshalText(text []byte) error {
+func (h *Hash) UnmarshalText(text []byte) error {
+	if len(text) != hashLength {
+		return errInvalidTextLength
+	}
 	_, err := base64.StdEncoding.Decode(h[:], text)
 	return err
 }
@@ -0,0 +1,206 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+
+	"github.com/lienkolabs/swell/crypto/edwards25519"
+)
+
+// ECVRF-EDWARDS25519-SHA512-TAI as specified by RFC 9381. The key pair is the
+// ed25519 key pair, so every validator token can verify VRF proofs.
+
+const (
+	VRFProofSize  = 80
+	VRFOutputSize = 64
+	vrfSuite      = 0x03
+	vrfChallenge  = 16
+)
+
+type VRFProof [VRFProofSize]byte
+
+func (p VRFProof) MarshalText() (text []byte, err error) {
+	text = make([]byte, 2*VRFProofSize)
+	hex.Encode(text, p[:])
+	return
+}
+
+func (p *VRFProof) UnmarshalText(text []byte) error {
+	if len(text) != 2*VRFProofSize {
+		return errInvalidTextLength
+	}
+	_, err := hex.Decode(p[:], text)
+	return err
+}
+
+type VRFOutput [VRFOutputSize]byte
+
+// decodePoint decodes a point as RFC 8032 does, rejecting non canonical
+// encodings.
+func decodePoint(p *edwards25519.ExtendedGroupElement, s *[32]byte) bool {
+	if !p.FromBytes(s) {
+		return false
+	}
+	var check [32]byte
+	p.ToBytes(&check)
+	return check == *s
+}
+
+func mulByCofactor(r, p *edwards25519.ExtendedGroupElement) {
+	var t edwards25519.CompletedGroupElement
+	var s edwards25519.ProjectiveGroupElement
+	p.Double(&t)
+	t.ToProjective(&s)
+	s.Double(&t)
+	t.ToProjective(&s)
+	s.Double(&t)
+	t.ToExtended(r)
+}
+
+// vrfHashToCurve is the try-and-increment encode_to_curve of the suite.
+func vrfHashToCurve(H *edwards25519.ExtendedGroupElement, publicKey []byte, alpha []byte) bool {
+	h := sha512.New()
+	var digest [64]byte
+	var candidate [32]byte
+	var point edwards25519.ExtendedGroupElement
+	for ctr := 0; ctr < 256; ctr++ {
+		h.Reset()
+		h.Write([]byte{vrfSuite, 0x01})
+		h.Write(publicKey)
+		h.Write(alpha)
+		h.Write([]byte{byte(ctr), 0x00})
+		h.Sum(digest[:0])
+		copy(candidate[:], digest[:32])
+		if decodePoint(&point, &candidate) {
+			mulByCofactor(H, &point)
+			return true
+		}
+	}
+	return false
+}
+
+func vrfChallengeHash(points ...*[32]byte) [32]byte {
+	h := sha512.New()
+	h.Write([]byte{vrfSuite, 0x02})
+	for _, point := range points {
+		h.Write(point[:])
+	}
+	h.Write([]byte{0x00})
+	var digest [64]byte
+	h.Sum(digest[:0])
+	var c [32]byte
+	copy(c[:vrfChallenge], digest[:vrfChallenge])
+	return c
+}
+
+func vrfProofToHash(gamma *edwards25519.ExtendedGroupElement) VRFOutput {
+	var cofactorGamma edwards25519.ExtendedGroupElement
+	mulByCofactor(&cofactorGamma, gamma)
+	var encoded [32]byte
+	cofactorGamma.ToBytes(&encoded)
+	h := sha512.New()
+	h.Write([]byte{vrfSuite, 0x03})
+	h.Write(encoded[:])
+	h.Write([]byte{0x00})
+	var output VRFOutput
+	h.Sum(output[:0])
+	return output
+}
+
+// VRFProve returns the proof that output is the VRF output of alpha under the
+// key.
+func (p PrivateKey) VRFProve(alpha []byte) (VRFProof, VRFOutput) {
+	var proof VRFProof
+	var digest [64]byte
+	h := sha512.New()
+	h.Write(p[:32])
+	h.Sum(digest[:0])
+	var x [32]byte
+	copy(x[:], digest[:32])
+	x[0] &= 248
+	x[31] &= 63
+	x[31] |= 64
+
+	var H, gamma, U, V edwards25519.ExtendedGroupElement
+	if !vrfHashToCurve(&H, p[32:], alpha) {
+		// the probability of 256 failures is negligible
+		panic("could not hash to curve")
+	}
+	var encodedH, encodedGamma, encodedU, encodedV [32]byte
+	H.ToBytes(&encodedH)
+	edwards25519.GeScalarMult(&gamma, &x, &H)
+	gamma.ToBytes(&encodedGamma)
+
+	var nonceDigest [64]byte
+	h.Reset()
+	h.Write(digest[32:])
+	h.Write(encodedH[:])
+	h.Sum(nonceDigest[:0])
+	var k [32]byte
+	edwards25519.ScReduce(&k, &nonceDigest)
+	edwards25519.GeScalarMultBase(&U, &k)
+	edwards25519.GeScalarMult(&V, &k, &H)
+	U.ToBytes(&encodedU)
+	V.ToBytes(&encodedV)
+
+	var publicKey [32]byte
+	copy(publicKey[:], p[32:])
+	c := vrfChallengeHash(&publicKey, &encodedH, &encodedGamma, &encodedU, &encodedV)
+	var s [32]byte
+	edwards25519.ScMulAdd(&s, &c, &x, &k)
+
+	copy(proof[:32], encodedGamma[:])
+	copy(proof[32:48], c[:vrfChallenge])
+	copy(proof[48:], s[:])
+	return proof, vrfProofToHash(&gamma)
+}
+
+// VRFVerify checks proof for alpha under the token and returns the VRF
+// output. Tokens of small order are rejected.
+func (t Token) VRFVerify(alpha []byte, proof VRFProof) (VRFOutput, bool) {
+	publicKey := [32]byte(t)
+	var Y, gamma, H edwards25519.ExtendedGroupElement
+	if !decodePoint(&Y, &publicKey) {
+		return VRFOutput{}, false
+	}
+	var cofactorY edwards25519.ExtendedGroupElement
+	var projective edwards25519.ProjectiveGroupElement
+	mulByCofactor(&cofactorY, &Y)
+	cofactorY.ToProjective(&projective)
+	if projective.IsIdentity() {
+		return VRFOutput{}, false
+	}
+	var encodedGamma, c, s [32]byte
+	copy(encodedGamma[:], proof[:32])
+	copy(c[:vrfChallenge], proof[32:48])
+	copy(s[:], proof[48:])
+	if !decodePoint(&gamma, &encodedGamma) || !edwards25519.ScMinimal(&s) {
+		return VRFOutput{}, false
+	}
+	if !vrfHashToCurve(&H, publicKey[:], alpha) {
+		return VRFOutput{}, false
+	}
+	var encodedH, encodedU, encodedV [32]byte
+	H.ToBytes(&encodedH)
+
+	// U = s*B - c*Y and V = s*H - c*Gamma
+	edwards25519.FeNeg(&Y.X, &Y.X)
+	edwards25519.FeNeg(&Y.T, &Y.T)
+	var minusGamma edwards25519.ExtendedGroupElement
+	minusGamma = gamma
+	edwards25519.FeNeg(&minusGamma.X, &minusGamma.X)
+	edwards25519.FeNeg(&minusGamma.T, &minusGamma.T)
+	var U, V edwards25519.ProjectiveGroupElement
+	edwards25519.GeDoubleScalarMultVartime(&U, &c, &Y, &s)
+	var zero [32]byte
+	edwards25519.GeMultiScalarMultVartime(&V, &zero, []*[32]byte{&s, &c}, []*edwards25519.ExtendedGroupElement{&H, &minusGamma})
+	U.ToBytes(&encodedU)
+	V.ToBytes(&encodedV)
+
+	check := vrfChallengeHash(&publicKey, &encodedH, &encodedGamma, &encodedU, &encodedV)
+	if !bytes.Equal(check[:vrfChallenge], c[:vrfChallenge]) {
+		return VRFOutput{}, false
+	}
+	return vrfProofToHash(&gamma), true
+}
@@ -0,0 +1,58 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// vrfVectors are ECVRF-EDWARDS25519-SHA512-TAI examples of RFC 9381. Only the
+// output is checked for vectors without proof.
+var vrfVectors = []struct {
+	secret, public, alpha, proof, output string
+}{
+	{
+		"9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60",
+		"d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		"",
+		"8657106690b5526245a92b003bb079ccd1a92130477671f6fc01ad16f26f723f26f8a57ccaed74ee1b190bed1f479d9727d2d0f9b005a6e456a35d4fb0daab1268a1b0db10836d9826a528ca76567805",
+		"90cf1df3b703cce59e2a35b925d411164068269d7b2d29f3301c03dd757876ff66b71dda49d2de59d03450451af026798e8f81cd2e333de5cdf4f3e140fdd8ae",
+	},
+	{
+		"4ccd089b28ff96da9db6c346ec114e0f5b8a319f35aba624da8cf6ed4fb8a6fb",
+		"3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c",
+		"72",
+		"",
+		"eb4440665d3891d668e7e0fcaf587f1b4bd7fbfe99d0eb2211ccec90496310eb5e33821bc613efb94db5e5b54c70a848a0bef4553a41befc57663b56373a5031",
+	},
+}
+
+func TestVRFVectors(t *testing.T) {
+	for n, vector := range vrfVectors {
+		var seed [32]byte
+		secret, _ := hex.DecodeString(vector.secret)
+		copy(seed[:], secret)
+		key := PrivateKeyFromSeed(seed)
+		if hex.EncodeToString(key[32:]) != vector.public {
+			t.Fatalf("vector %v: wrong public key", n)
+		}
+		alpha, _ := hex.DecodeString(vector.alpha)
+		proof, output := key.VRFProve(alpha)
+		if vector.proof != "" && hex.EncodeToString(proof[:]) != vector.proof {
+			t.Errorf("vector %v: wrong proof %x", n, proof)
+		}
+		if hex.EncodeToString(output[:]) != vector.output {
+			t.Errorf("vector %v: wrong output %x", n, output)
+		}
+		verified, ok := key.PublicKey().VRFVerify(alpha, proof)
+		if !ok || verified != output {
+			t.Errorf("vector %v: proof rejected", n)
+		}
+		if _, ok := key.PublicKey().VRFVerify(append(alpha, 0), proof); ok {
+			t.Errorf("vector %v: proof accepted for another input", n)
+		}
+		proof[40] ^= 1
+		if _, ok := key.PublicKey().VRFVerify(alpha, proof); ok {
+			t.Errorf("vector %v: tampered proof accepted", n)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/lienkolabs/swell/crypto/edwards25519"
+)
+
+// smallOrderEncodings are the 8 canonical and 6 non-canonical encodings of
+// the points of small order, as used by the ZIP-215 test vectors.
+var smallOrderEncodings = []string{
+	"0100000000000000000000000000000000000000000000000000000000000000",
+	"c7176a703d4dd84fba3c0b760d10670f2a2053fa2c39ccc64ec7fd7792ac037a",
+	"0000000000000000000000000000000000000000000000000000000000000080",
+	"26e8958fc2b227b045c3f489f2ef98f0d5dfac05d3c63339b13802886d53fc05",
+	"ecffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f",
+	"26e8958fc2b227b045c3f489f2ef98f0d5dfac05d3c63339b13802886d53fc85",
+	"0000000000000000000000000000000000000000000000000000000000000000",
+	"c7176a703d4dd84fba3c0b760d10670f2a2053fa2c39ccc64ec7fd7792ac03fa",
+	"0100000000000000000000000000000000000000000000000000000000000080",
+	"ecffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+	"eeffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f",
+	"eeffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+	"edffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f",
+	"edffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+}
+
+func decodeSmallOrder(t *testing.T) [][32]byte {
+	encodings := make([][32]byte, len(smallOrderEncodings))
+	for n, text := range smallOrderEncodings {
+		bytes, _ := hex.DecodeString(text)
+		copy(encodings[n][:], bytes)
+		var point edwards25519.ExtendedGroupElement
+		if !point.FromBytes(&encodings[n]) {
+			t.Fatalf("encoding %v is not a point", n)
+		}
+		var projective, cofactored edwards25519.ProjectiveGroupElement
+		point.ToProjective(&projective)
+		projective.MulByCofactor(&cofactored)
+		if !cofactored.IsIdentity() {
+			t.Fatalf("encoding %v is not of small order", n)
+		}
+	}
+	return encodings
+}
+
+// TestZIP215Vectors checks the 196 ZIP-215 vectors: the message "Zcash"
+// signed with S = 0 for every combination of small order A and R. All of them
+// must be accepted, individually and in a batch, while the cofactorless
+// Verify rejects some of them.
+func TestZIP215Vectors(t *testing.T) {
+	encodings := decodeSmallOrder(t)
+	msg := []byte("Zcash")
+	batch := NewBatchVerifier()
+	legacy := 0
+	for a, A := range encodings {
+		for r, R := range encodings {
+			var signature Signature
+			copy(signature[:32], R[:])
+			if !Token(A).VerifyZIP215(msg, signature) {
+				t.Errorf("vector A=%v R=%v rejected", a, r)
+			}
+			if Token(A).Verify(msg, signature) {
+				legacy += 1
+			}
+			batch.Add(Token(A), msg, signature)
+		}
+	}
+	if legacy == len(encodings)*len(encodings) {
+		t.Error("expected Verify to reject some of the vectors")
+	}
+	if !batch.verifyBatch() {
+		t.Error("batch of the ZIP-215 vectors rejected")
+	}
+}
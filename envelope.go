@@ -0,0 +1,170 @@
+package swell
+
+import (
+	"sync"
+
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/util"
+)
+
+// SignedEvent is an optional envelope for events authored by a token. It is
+// serialized as
+//
+//	[Version][clock: 8 bytes][signedEventTag][author: 32 bytes][payload][signature: 64 bytes]
+//
+// so that it is also a valid Event. The signature is over every preceding
+// byte. Events without the tag are not envelopes.
+type SignedEvent struct {
+	Clock     uint64
+	Author    crypto.Token
+	Payload   []byte
+	Signature crypto.Signature
+}
+
+// signedEventTag follows the version and clock of an envelope. Applications
+// must not emit events that start with it unless they are envelopes.
+const signedEventTag = "\x00swell/signed"
+
+const signedEventOverhead = 1 + 8 + len(signedEventTag) + crypto.TokenSize + crypto.SignatureSize
+
+// IsSignedEvent checks if event is tagged as an envelope, without checking
+// its signature.
+func IsSignedEvent(event Event) bool {
+	return len(event) >= signedEventOverhead && event[0] == Version && string(event[9:9+len(signedEventTag)]) == signedEventTag
+}
+
+// NewSignedEvent creates an event for clock with payload signed by key.
+func NewSignedEvent(clock uint64, payload []byte, key crypto.PrivateKey) Event {
+	signed := SignedEvent{Clock: clock, Author: key.PublicKey(), Payload: payload}
+	bytes := signed.serializeToSign()
+	signed.Signature = key.Sign(bytes)
+	util.PutSignature(signed.Signature, &bytes)
+	return Event(bytes)
+}
+
+func (s *SignedEvent) serializeToSign() []byte {
+	bytes := []byte{Version}
+	util.PutUint64(s.Clock, &bytes)
+	bytes = append(bytes, signedEventTag...)
+	util.PutToken(s.Author, &bytes)
+	return append(bytes, s.Payload...)
+}
+
+func (s *SignedEvent) Serialize() Event {
+	bytes := s.serializeToSign()
+	util.PutSignature(s.Signature, &bytes)
+	return Event(bytes)
+}
+
+// ParseSignedEvent parses event as a SignedEvent. It returns nil if event is
+// not an envelope or its signature does not match the author.
+func ParseSignedEvent(event Event) *SignedEvent {
+	if !IsSignedEvent(event) {
+		return nil
+	}
+	signed := SignedEvent{}
+	signed.Clock, _ = util.ParseUint64(event, 1)
+	var position int
+	signed.Author, position = util.ParseToken(event, 9+len(signedEventTag))
+	end := len(event) - crypto.SignatureSize
+	signed.Payload = event[position:end]
+	signed.Signature, _ = util.ParseSignature(event, end)
+	if !signed.Author.VerifyZIP215(event[:end], signed.Signature) {
+		return nil
+	}
+	return &signed
+}
+
+// EventAuthor returns the author of a signed event without checking its
+// signature, or the zero token if event is not an envelope. It can be used as
+// the SenderFunc of a FairPolicy.
+func EventAuthor(event Event) crypto.Token {
+	if !IsSignedEvent(event) {
+		return crypto.ZeroToken
+	}
+	author, _ := util.ParseToken(event, 9+len(signedEventTag))
+	return author
+}
+
+// EventVerifier checks the signature of signed events on a pool of workers
+// and forwards the valid ones, and every event that is not an envelope, into
+// output, so that envelopes with invalid signatures never reach the state
+// machine or the EventsPool. Events are forwarded in the order their
+// verification completes. Every Communication verifies the events received on
+// IncomingEvent into Events.
+type EventVerifier struct {
+	mu      sync.Mutex
+	input   chan Event
+	output  chan<- Event
+	quit    chan struct{}
+	done    sync.WaitGroup
+	dropped uint64
+}
+
+// NewEventVerifier starts workers goroutines verifying events sent to Input
+// and forwarding them to output.
+func NewEventVerifier(workers int, output chan<- Event) *EventVerifier {
+	if workers < 1 {
+		workers = 1
+	}
+	verifier := &EventVerifier{input: make(chan Event, 2*workers), output: output, quit: make(chan struct{})}
+	verifier.done.Add(workers)
+	for n := 0; n < workers; n++ {
+		go verifier.work()
+	}
+	return verifier
+}
+
+func (v *EventVerifier) work() {
+	defer v.done.Done()
+	for {
+		var event Event
+		select {
+		case received, ok := <-v.input:
+			if !ok {
+				return
+			}
+			event = received
+		case <-v.quit:
+			return
+		}
+		if !IsSignedEvent(event) || ParseSignedEvent(event) != nil {
+			select {
+			case v.output <- event:
+			case <-v.quit:
+				return
+			}
+		} else {
+			v.mu.Lock()
+			v.dropped += 1
+			v.mu.Unlock()
+		}
+	}
+}
+
+// Input is the channel on which events are submitted for verification.
+func (v *EventVerifier) Input() chan<- Event {
+	return v.input
+}
+
+// Dropped returns the number of envelopes discarded for invalid signatures.
+func (v *EventVerifier) Dropped() uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.dropped
+}
+
+// Close stops accepting events and returns once every submitted event has
+// been forwarded or dropped.
+func (v *EventVerifier) Close() {
+	close(v.input)
+	v.done.Wait()
+}
+
+// Stop returns once every worker exited, discarding the events not yet
+// forwarded, for outputs no longer read. Events sent to Input after Stop are
+// never forwarded.
+func (v *EventVerifier) Stop() {
+	close(v.quit)
+	v.done.Wait()
+}
@@ -0,0 +1,52 @@
+package swell
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+func TestSignedEventVerifier(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	valid := NewSignedEvent(7, []byte("payload"), key)
+	signed := ParseSignedEvent(valid)
+	if signed == nil || signed.Clock != 7 || signed.Author != token || string(signed.Payload) != "payload" {
+		t.Fatal("could not parse signed event")
+	}
+	if valid.Clock() != 7 || EventAuthor(valid) != token {
+		t.Error("signed event is not a valid event")
+	}
+	tampered := append(Event{}, valid...)
+	tampered[len(tampered)-crypto.SignatureSize-1] ^= 1
+	if ParseSignedEvent(tampered) != nil {
+		t.Error("tampered event accepted")
+	}
+
+	plain := newEvent(7, 1)
+	if IsSignedEvent(plain) || EventAuthor(plain) != crypto.ZeroToken || ParseSignedEvent(plain) != nil {
+		t.Error("event without envelope taken as signed")
+	}
+
+	output := make(chan Event, 150)
+	verifier := NewEventVerifier(4, output)
+	for n := 0; n < 50; n++ {
+		verifier.Input() <- NewSignedEvent(uint64(n), []byte{byte(n)}, key)
+		verifier.Input() <- tampered
+		verifier.Input() <- plain
+	}
+	verifier.Close()
+	if len(output) != 100 || verifier.Dropped() != 50 {
+		t.Errorf("expected 100 forwarded and 50 dropped, got %v and %v", len(output), verifier.Dropped())
+	}
+
+	comm := NewCommunication()
+	comm.IncomingEvent <- tampered
+	comm.IncomingEvent <- plain
+	if event := <-comm.Events; !bytes.Equal(event, plain) {
+		t.Error("communication did not verify incoming events")
+	}
+	// closing stops the workers even if nobody reads the events
+	comm.IncomingEvent <- plain
+	comm.Close()
+}
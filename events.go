@@ -9,11 +9,11 @@ import (
 
 // Any valid transaction must start with Version on byte[0] and have the clock as
 // measured in blocks since genesis set on the following 8 bytes. Encoding is
-// little-endian.
+// little-endian. In JSON an event is encoded in base64.
 type Event []byte
 
 func (t Event) Clock() uint64 {
-	if t[0] != Version || len(t) < 9 {
+	if len(t) < 9 || t[0] != Version {
 		return 0
 	}
 	clock, _ := util.ParseUint64(t, 1)
@@ -26,53 +26,264 @@ func (t Event) Hash() crypto.Hash {
 
 type Events []Event
 
+// PoolConfig limits the resources held by an EventsPool. A zero value means
+// no limit. Events older than MaxAge clocks with respect to the pool clock
+// are expired.
+type PoolConfig struct {
+	MaxCount int
+	MaxBytes int
+	MaxAge   uint64
+}
+
+type PoolStats struct {
+	Count      int    // events currently in the pool
+	Bytes      int    // bytes currently in the pool
+	Queued     uint64 // events accepted
+	Unqueued   uint64 // events taken by Unqueue
+	Deleted    uint64 // events removed by Delete, DeleteArray or DeleteEvents
+	Evicted    uint64 // events dropped to respect MaxCount or MaxBytes
+	Expired    uint64 // events dropped for being older than MaxAge
+	Duplicates uint64 // events rejected for being already in the pool
+	Rejected   uint64 // events rejected for being too large or too old
+}
+
+// PoolEntry is an event held by an EventsPool. Sequence is the arrival order
+// of the event in the pool.
+type PoolEntry struct {
+	Event    Event
+	Hash     crypto.Hash
+	Sequence uint64
+	clock    uint64
+	older    *PoolEntry // previous entry with the same clock
+	newer    *PoolEntry // next entry with the same clock
+	prev     *PoolEntry // bookkeeping of the built-in ordering policies
+	next     *PoolEntry
+	index    int
+	priority uint64
+}
+
+type clockBucket struct {
+	first, last *PoolEntry
+}
+
+// EventsPool keeps the events waiting to be incorporated into a block. The
+// order in which they leave the pool is decided by an OrderingPolicy. Queue,
+// Unqueue and Delete are O(1) under the FIFO policy: entries are indexed by
+// hash and the policy keeps them linked in arrival order. Entries are also
+// grouped by Event.Clock so that when the pool is over its limits the events
+// with the oldest clock are evicted first.
 type EventsPool struct {
-	queue  []crypto.Hash // order in which instructions are received
-	events map[crypto.Hash]Event
-	mu     sync.Mutex
+	mu       sync.Mutex
+	config   PoolConfig
+	policy   OrderingPolicy
+	events   map[crypto.Hash]*PoolEntry
+	buckets  map[uint64]*clockBucket
+	oldest   uint64 // lowest clock with a bucket, valid when buckets is not empty
+	clock    uint64
+	sequence uint64
+	stats    PoolStats
 }
 
-func NewInstructionPool() *EventsPool {
+// NewEventsPool returns a pool bounded by config and ordered by policy. If
+// policy is nil events are ordered first in first out.
+func NewEventsPool(config PoolConfig, policy OrderingPolicy) *EventsPool {
+	if policy == nil {
+		policy = NewFIFOPolicy()
+	}
 	return &EventsPool{
-		queue:  make([]crypto.Hash, 0),
-		events: make(map[crypto.Hash]Event),
+		config:  config,
+		policy:  policy,
+		events:  make(map[crypto.Hash]*PoolEntry),
+		buckets: make(map[uint64]*clockBucket),
 	}
 }
 
-func (pool *EventsPool) Unqueue() (Event, crypto.Hash) {
-	if len(pool.queue) == 0 {
-		return nil, crypto.ZeroHash
+// NewInstructionPool returns a first in first out pool without limits.
+func NewInstructionPool() *EventsPool {
+	return NewEventsPool(PoolConfig{}, nil)
+}
+
+func (pool *EventsPool) link(entry *PoolEntry) {
+	pool.policy.Push(entry)
+	bucket, ok := pool.buckets[entry.clock]
+	if !ok {
+		bucket = &clockBucket{}
+		if len(pool.buckets) == 0 || entry.clock < pool.oldest {
+			pool.oldest = entry.clock
+		}
+		pool.buckets[entry.clock] = bucket
 	}
+	entry.older = bucket.last
+	if bucket.last != nil {
+		bucket.last.newer = entry
+	} else {
+		bucket.first = entry
+	}
+	bucket.last = entry
+	pool.events[entry.Hash] = entry
+	pool.stats.Bytes += len(entry.Event)
+}
+
+// unlink removes entry from the pool indexes. Unless popped is true the entry
+// is also removed from the ordering policy.
+func (pool *EventsPool) unlink(entry *PoolEntry, popped bool) {
+	if !popped {
+		pool.policy.Remove(entry)
+	}
+	bucket := pool.buckets[entry.clock]
+	if entry.older != nil {
+		entry.older.newer = entry.newer
+	} else {
+		bucket.first = entry.newer
+	}
+	if entry.newer != nil {
+		entry.newer.older = entry.older
+	} else {
+		bucket.last = entry.older
+	}
+	if bucket.first == nil {
+		delete(pool.buckets, entry.clock)
+		if entry.clock == pool.oldest {
+			pool.findOldest()
+		}
+	}
+	delete(pool.events, entry.Hash)
+	pool.stats.Bytes -= len(entry.Event)
+	entry.older, entry.newer = nil, nil
+}
+
+// findOldest scans the buckets for the lowest clock. It runs only when the
+// bucket of the oldest clock is emptied, and the number of buckets is bounded
+// by the number of distinct clocks in the pool.
+func (pool *EventsPool) findOldest() {
+	first := true
+	for clock := range pool.buckets {
+		if first || clock < pool.oldest {
+			pool.oldest = clock
+			first = false
+		}
+	}
+}
+
+func (pool *EventsPool) overLimits() bool {
+	if pool.config.MaxCount > 0 && len(pool.events) > pool.config.MaxCount {
+		return true
+	}
+	return pool.config.MaxBytes > 0 && pool.stats.Bytes > pool.config.MaxBytes
+}
+
+func (pool *EventsPool) expired(clock uint64) bool {
+	return pool.config.MaxAge > 0 && clock+pool.config.MaxAge < pool.clock
+}
+
+// Queue appends event to the end of the pool. It returns false if the event
+// is already in the pool, is too large or too old to be kept, or was itself
+// evicted because every other event in the pool is more recent.
+func (pool *EventsPool) Queue(event Event, hash crypto.Hash) bool {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
-	for n, hash := range pool.queue {
-		if event, ok := pool.events[hash]; ok {
-			pool.queue = pool.queue[n+1:]
-			delete(pool.events, hash)
-			return event, hash
-		}
+	if _, ok := pool.events[hash]; ok {
+		pool.stats.Duplicates += 1
+		return false
+	}
+	clock := event.Clock()
+	if (pool.config.MaxBytes > 0 && len(event) > pool.config.MaxBytes) || pool.expired(clock) {
+		pool.stats.Rejected += 1
+		return false
+	}
+	pool.sequence += 1
+	entry := &PoolEntry{Event: event, Hash: hash, Sequence: pool.sequence, clock: clock}
+	pool.link(entry)
+	pool.stats.Queued += 1
+	for pool.overLimits() {
+		pool.unlink(pool.buckets[pool.oldest].first, false)
+		pool.stats.Evicted += 1
 	}
-	pool.queue = pool.queue[:0]
-	return nil, crypto.ZeroHash
+	_, ok := pool.events[hash]
+	return ok
 }
 
-func (pool *EventsPool) Queue(event Event, hash crypto.Hash) {
+// Unqueue removes and returns the next event according to the pool ordering
+// policy. It returns nil and crypto.ZeroHash if the pool is empty.
+func (pool *EventsPool) Unqueue() (Event, crypto.Hash) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
-	pool.queue = append(pool.queue, hash)
-	pool.events[hash] = event
+	entry := pool.policy.Pop()
+	if entry == nil {
+		return nil, crypto.ZeroHash
+	}
+	pool.unlink(entry, true)
+	pool.stats.Unqueued += 1
+	return entry.Event, entry.Hash
+}
+
+// Peek returns the event Unqueue would return without removing it from the
+// pool.
+func (pool *EventsPool) Peek() (Event, crypto.Hash) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	entry := pool.policy.Peek()
+	if entry == nil {
+		return nil, crypto.ZeroHash
+	}
+	return entry.Event, entry.Hash
 }
 
 func (pool *EventsPool) Delete(hash crypto.Hash) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
-	delete(pool.events, hash)
+	pool.delete(hash)
 }
 
 func (pool *EventsPool) DeleteArray(hashes []crypto.Hash) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 	for _, hash := range hashes {
-		delete(pool.events, hash)
+		pool.delete(hash)
+	}
+}
+
+// DeleteEvents removes the events of a finalized block.
+func (pool *EventsPool) DeleteEvents(events Events) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, event := range events {
+		pool.delete(event.Hash())
 	}
 }
+
+func (pool *EventsPool) delete(hash crypto.Hash) {
+	if entry, ok := pool.events[hash]; ok {
+		pool.unlink(entry, false)
+		pool.stats.Deleted += 1
+	}
+}
+
+// SetClock advances the pool clock and drops every event older than MaxAge
+// with respect to the new clock.
+func (pool *EventsPool) SetClock(clock uint64) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if clock <= pool.clock {
+		return
+	}
+	pool.clock = clock
+	for len(pool.buckets) > 0 && pool.expired(pool.oldest) {
+		pool.unlink(pool.buckets[pool.oldest].first, false)
+		pool.stats.Expired += 1
+	}
+}
+
+func (pool *EventsPool) Len() int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return len(pool.events)
+}
+
+func (pool *EventsPool) Stats() PoolStats {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	stats := pool.stats
+	stats.Count = len(pool.events)
+	return stats
+}
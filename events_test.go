@@ -0,0 +1,110 @@
+package swell
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/swell/crypto"
+
+	"github.com/lienkolabs/swell/util"
+)
+
+func newEvent(clock uint64, payload byte) Event {
+	event := []byte{Version}
+	util.PutUint64(clock, &event)
+	return Event(append(event, payload))
+}
+
+func TestPoolOrder(t *testing.T) {
+	pool := NewInstructionPool()
+	events := make(Events, 0)
+	for n := 0; n < 10; n++ {
+		event := newEvent(uint64(n%3), byte(n))
+		events = append(events, event)
+		if !pool.Queue(event, event.Hash()) {
+			t.Fatal("event rejected")
+		}
+	}
+	if pool.Queue(events[0], events[0].Hash()) {
+		t.Fatal("duplicate event accepted")
+	}
+	pool.Delete(events[0].Hash())
+	pool.DeleteArray([]crypto.Hash{events[4].Hash(), events[9].Hash()})
+	for _, n := range []int{1, 2, 3, 5, 6, 7, 8} {
+		event, hash := pool.Unqueue()
+		if hash != events[n].Hash() || string(event) != string(events[n]) {
+			t.Fatalf("wrong order: expected event %v", n)
+		}
+	}
+	if event, _ := pool.Unqueue(); event != nil {
+		t.Fatal("empty pool returned event")
+	}
+	if stats := pool.Stats(); stats.Count != 0 || stats.Bytes != 0 || stats.Deleted != 3 || stats.Duplicates != 1 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+}
+
+func TestPoolEviction(t *testing.T) {
+	pool := NewEventsPool(PoolConfig{MaxCount: 3, MaxAge: 5}, nil)
+	for _, clock := range []uint64{10, 8, 12, 9} {
+		event := newEvent(clock, 0)
+		pool.Queue(event, event.Hash())
+	}
+	// the event with clock 8 is the oldest and must have been evicted
+	for _, clock := range []uint64{10, 12, 9} {
+		if event, _ := pool.Unqueue(); event.Clock() != clock {
+			t.Fatalf("expected clock %v, got %v", clock, event.Clock())
+		}
+	}
+	for _, clock := range []uint64{10, 14, 11} {
+		event := newEvent(clock, 1)
+		pool.Queue(event, event.Hash())
+	}
+	pool.SetClock(16)
+	if event, _ := pool.Unqueue(); event.Clock() != 14 || pool.Len() != 1 {
+		t.Fatalf("events older than max age not expired")
+	}
+	old := newEvent(2, 2)
+	if pool.Queue(old, old.Hash()) {
+		t.Fatal("expired event accepted")
+	}
+	stats := pool.Stats()
+	if stats.Evicted != 1 || stats.Expired != 1 || stats.Rejected != 1 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+}
+
+func TestPoolPolicies(t *testing.T) {
+	fee := func(e Event) uint64 { return uint64(e[9]) }
+	pool := NewEventsPool(PoolConfig{}, NewFeePolicy(fee))
+	for _, payload := range []byte{3, 7, 1, 7, 5} {
+		event := newEvent(uint64(payload), payload)
+		event = append(event, byte(pool.Len()))
+		pool.Queue(event, event.Hash())
+	}
+	expected := [][2]byte{{7, 1}, {7, 3}, {5, 4}, {3, 0}, {1, 2}}
+	for _, e := range expected {
+		next, _ := pool.Peek()
+		if event, _ := pool.Unqueue(); event[9] != e[0] || event[10] != e[1] || string(next) != string(event) {
+			t.Fatalf("wrong fee order: expected %v got %v", e, event[9:])
+		}
+	}
+
+	sender := func(e Event) crypto.Token { return crypto.Token{e[9]} }
+	pool = NewEventsPool(PoolConfig{}, NewFairPolicy(sender))
+	events := make(Events, 0)
+	for _, from := range []byte{1, 1, 1, 2, 3, 3} {
+		event := append(newEvent(1, from), byte(len(events)))
+		events = append(events, event)
+		pool.Queue(event, event.Hash())
+	}
+	pool.Delete(events[4].Hash())
+	for _, n := range []int{0, 3, 5, 1, 2} {
+		next, _ := pool.Peek()
+		if event, _ := pool.Unqueue(); string(event) != string(events[n]) || string(next) != string(event) {
+			t.Fatalf("wrong round-robin order: expected event %v", n)
+		}
+	}
+	if pool.Len() != 0 {
+		t.Fatal("pool not empty")
+	}
+}
@@ -0,0 +1,264 @@
+package swell
+
+import (
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/util"
+)
+
+const (
+	DoubleProposal byte = iota // a publisher signed two blocks for the same clock
+	DoubleSign                 // a validator signed two blocks for the same clock
+)
+
+// EvidenceWindow is the number of clocks around the tip of a chain within
+// which evidence is accepted, and for which engines keep what they need to
+// detect and deduplicate it.
+const EvidenceWindow = 100
+
+// Evidence proves that Offender equivocated at Clock. It carries the headers
+// of the two conflicting blocks and, for DoubleSign, the two validator
+// signatures, so that anyone can verify it without further context.
+type Evidence struct {
+	Kind       byte
+	Offender   crypto.Token
+	Clock      uint64
+	Headers    [2]*Block
+	Signatures [2]Signature
+}
+
+// Penalizer is implemented by states that punish equivocating validators.
+// The engine hands every new verified evidence to the state if it is one.
+// Nodes learn of evidence at different times, so the state should not apply
+// the penalty right away but, for example, submit the serialized evidence as
+// an event and apply it once finalized.
+type Penalizer interface {
+	Penalize(evidence *Evidence)
+}
+
+// NewDoubleProposal builds evidence from two different blocks signed by the
+// same publisher for the same clock. It returns nil otherwise.
+func NewDoubleProposal(first, second *Block) *Evidence {
+	evidence := &Evidence{Kind: DoubleProposal, Offender: first.Publisher, Clock: first.Clock, Headers: [2]*Block{header(first), header(second)}}
+	if !evidence.Verify() {
+		return nil
+	}
+	return evidence
+}
+
+// NewDoubleSign builds evidence from signatures by the same validator of two
+// different blocks for the same clock. It returns nil otherwise.
+func NewDoubleSign(first, second *Block, firstSignature, secondSignature Signature) *Evidence {
+	evidence := &Evidence{
+		Kind:       DoubleSign,
+		Offender:   firstSignature.Token,
+		Clock:      first.Clock,
+		Headers:    [2]*Block{header(first), header(second)},
+		Signatures: [2]Signature{firstSignature, secondSignature},
+	}
+	if !evidence.Verify() {
+		return nil
+	}
+	return evidence
+}
+
+// header returns a copy of block without events.
+func header(block *Block) *Block {
+	copied := *block
+	copied.Events = nil
+	return &copied
+}
+
+// Verify checks that the evidence proves an equivocation.
+func (e *Evidence) Verify() bool {
+	first, second := e.Headers[0], e.Headers[1]
+	if first == nil || second == nil || first.Clock != e.Clock || second.Clock != e.Clock {
+		return false
+	}
+	hashes := [2]crypto.Hash{first.Hash(), second.Hash()}
+	if hashes[0] == hashes[1] {
+		return false
+	}
+	for _, block := range e.Headers {
+		if !block.Publisher.VerifyZIP215(block.serializeHeader(), block.Signature) {
+			return false
+		}
+	}
+	switch e.Kind {
+	case DoubleProposal:
+		return first.Publisher == e.Offender && second.Publisher == e.Offender
+	case DoubleSign:
+		for n, signature := range e.Signatures {
+			if signature.Token != e.Offender || signature.Hash != hashes[n] {
+				return false
+			}
+			if !signature.Token.VerifyZIP215(signature.Hash[:], signature.Signature) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Hash identifies the equivocation regardless of the order of the blocks.
+func (e *Evidence) Hash() crypto.Hash {
+	first, second := e.Headers[0].Hash(), e.Headers[1].Hash()
+	bytes := []byte{e.Kind}
+	util.PutToken(e.Offender, &bytes)
+	if string(second[:]) < string(first[:]) {
+		first, second = second, first
+	}
+	util.PutHash(first, &bytes)
+	util.PutHash(second, &bytes)
+	return crypto.Hasher(bytes)
+}
+
+func (e *Evidence) Serialize() []byte {
+	bytes := []byte{e.Kind}
+	util.PutByteArray(e.Headers[0].SerializeHeader(), &bytes)
+	util.PutByteArray(e.Headers[1].SerializeHeader(), &bytes)
+	if e.Kind == DoubleSign {
+		bytes = append(bytes, e.Signatures[0].Serialize()...)
+		bytes = append(bytes, e.Signatures[1].Serialize()...)
+	}
+	return bytes
+}
+
+// ParseEvidence parses and verifies evidence. It returns nil if the evidence
+// does not prove an equivocation.
+func ParseEvidence(data []byte) *Evidence {
+	if len(data) == 0 {
+		return nil
+	}
+	evidence := Evidence{Kind: data[0]}
+	position := 1
+	for n := range evidence.Headers {
+		var bytes []byte
+		bytes, position = util.ParseByteArray(data, position)
+		if evidence.Headers[n] = ParseBlockHeader(bytes); evidence.Headers[n] == nil {
+			return nil
+		}
+	}
+	evidence.Clock = evidence.Headers[0].Clock
+	evidence.Offender = evidence.Headers[0].Publisher
+	if evidence.Kind == DoubleSign {
+		size := crypto.Size + crypto.TokenSize + crypto.SignatureSize
+		if position+2*size != len(data) {
+			return nil
+		}
+		for n := range evidence.Signatures {
+			evidence.Signatures[n] = *ParseSignature(data[position : position+size])
+			position += size
+		}
+		evidence.Offender = evidence.Signatures[0].Token
+	} else if position != len(data) {
+		return nil
+	}
+	if !evidence.Verify() {
+		return nil
+	}
+	return &evidence
+}
+
+// EquivocationDetector watches the blocks and signatures a node receives and
+// builds evidence when a publisher or a validator equivocates. Every
+// equivocation is reported only once until its clock is pruned.
+type EquivocationDetector struct {
+	blocks     map[uint64]map[crypto.Token]*Block
+	signatures map[uint64]map[crypto.Token]signedHeader
+	reported   map[crypto.Hash]uint64 // clock of the reported evidence
+}
+
+type signedHeader struct {
+	block     *Block
+	signature Signature
+}
+
+func NewEquivocationDetector() *EquivocationDetector {
+	return &EquivocationDetector{
+		blocks:     make(map[uint64]map[crypto.Token]*Block),
+		signatures: make(map[uint64]map[crypto.Token]signedHeader),
+		reported:   make(map[crypto.Hash]uint64),
+	}
+}
+
+func (d *EquivocationDetector) report(evidence *Evidence) *Evidence {
+	if evidence == nil {
+		return nil
+	}
+	hash := evidence.Hash()
+	if _, ok := d.reported[hash]; ok {
+		return nil
+	}
+	d.reported[hash] = evidence.Clock
+	return evidence
+}
+
+// Block records a block with a valid publisher signature and returns the
+// evidence of a double proposal if its publisher signed another block for the
+// same clock. Blocks without a valid publisher signature are ignored.
+func (d *EquivocationDetector) Block(block *Block) *Evidence {
+	if !block.Verify() {
+		return nil
+	}
+	published, ok := d.blocks[block.Clock]
+	if !ok {
+		published = make(map[crypto.Token]*Block)
+		d.blocks[block.Clock] = published
+	}
+	previous, ok := published[block.Publisher]
+	if !ok {
+		published[block.Publisher] = header(block)
+		return nil
+	}
+	if previous.Hash() == block.Hash() {
+		return nil
+	}
+	return d.report(NewDoubleProposal(previous, block))
+}
+
+// Signature records a valid signature of block and returns the evidence of a
+// double sign if the validator signed another block for the same clock.
+func (d *EquivocationDetector) Signature(block *Block, signature Signature) *Evidence {
+	signed, ok := d.signatures[block.Clock]
+	if !ok {
+		signed = make(map[crypto.Token]signedHeader)
+		d.signatures[block.Clock] = signed
+	}
+	previous, ok := signed[signature.Token]
+	if !ok {
+		signed[signature.Token] = signedHeader{block: header(block), signature: signature}
+		return nil
+	}
+	if previous.signature.Hash == signature.Hash {
+		return nil
+	}
+	return d.report(NewDoubleSign(previous.block, block, previous.signature, signature))
+}
+
+// Add records evidence received from a peer, which must have been checked
+// with BlockChain.VerifyEvidence. It returns false if the evidence was
+// already known.
+func (d *EquivocationDetector) Add(evidence *Evidence) bool {
+	return d.report(evidence) != nil
+}
+
+// Prune forgets the blocks, signatures and reported evidence of clocks up to
+// clock.
+func (d *EquivocationDetector) Prune(clock uint64) {
+	for hash, old := range d.reported {
+		if old <= clock {
+			delete(d.reported, hash)
+		}
+	}
+	for old := range d.blocks {
+		if old <= clock {
+			delete(d.blocks, old)
+		}
+	}
+	for old := range d.signatures {
+		if old <= clock {
+			delete(d.signatures, old)
+		}
+	}
+}
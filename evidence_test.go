@@ -0,0 +1,76 @@
+package swell
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+func TestEquivocationDetector(t *testing.T) {
+	_, publisher := crypto.RandomAsymetricKey()
+	validator, key := crypto.RandomAsymetricKey()
+	blocks := make([]*Block, 2)
+	for n := range blocks {
+		blocks[n] = &Block{Clock: 7, Publisher: publisher.PublicKey(), PublishedAt: time.Unix(7, 0), Events: Events{newEvent(7, byte(n))}}
+		blocks[n].Sign(publisher)
+	}
+	detector := NewEquivocationDetector()
+	forgedBlock := *blocks[0]
+	forgedBlock.Events = Events{newEvent(7, 9)}
+	forgedBlock.EventsRoot = MerkleRoot(forgedBlock.Events)
+	if detector.Block(&forgedBlock) != nil {
+		t.Fatal("evidence from a forged block")
+	}
+	if detector.Block(blocks[0]) != nil || detector.Block(blocks[0]) != nil {
+		t.Fatal("evidence from a single block")
+	}
+	proposal := detector.Block(blocks[1])
+	if proposal == nil || proposal.Kind != DoubleProposal || proposal.Offender != publisher.PublicKey() {
+		t.Fatal("double proposal not detected")
+	}
+	if detector.Block(blocks[1]) != nil {
+		t.Error("double proposal reported twice")
+	}
+
+	signatures := make([]Signature, 2)
+	for n, block := range blocks {
+		hash := block.Hash()
+		signatures[n] = Signature{Hash: hash, Token: validator, Signature: key.Sign(hash[:])}
+	}
+	if detector.Signature(blocks[0], signatures[0]) != nil {
+		t.Fatal("evidence from a single signature")
+	}
+	sign := detector.Signature(blocks[1], signatures[1])
+	if sign == nil || sign.Kind != DoubleSign || sign.Offender != validator {
+		t.Fatal("double sign not detected")
+	}
+
+	for _, evidence := range []*Evidence{proposal, sign} {
+		parsed := ParseEvidence(evidence.Serialize())
+		if parsed == nil || parsed.Hash() != evidence.Hash() || parsed.Offender != evidence.Offender {
+			t.Errorf("evidence %v does not survive serialization", evidence.Kind)
+		}
+		if !NewEquivocationDetector().Add(parsed) || detector.Add(parsed) {
+			t.Error("wrong deduplication of received evidence")
+		}
+	}
+	// evidence is accepted only against validators near the tip
+	chain := &BlockChain{Validators: []Validator{{Token: validator, Stake: 1}}, TotalStake: 1}
+	if !chain.VerifyEvidence(sign) || chain.VerifyEvidence(proposal) {
+		t.Error("evidence accepted regardless of the stake of the offender")
+	}
+	chain.Epoch = 7 + EvidenceWindow + 1
+	if chain.VerifyEvidence(sign) {
+		t.Error("evidence older than the window accepted")
+	}
+	detector.Prune(7)
+	if !detector.Add(sign) {
+		t.Error("reported evidence not pruned")
+	}
+	forged := *sign
+	forged.Signatures[1] = signatures[0]
+	if forged.Verify() || ParseEvidence(forged.Serialize()) != nil {
+		t.Error("forged evidence accepted")
+	}
+}
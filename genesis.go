@@ -0,0 +1,145 @@
+package swell
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/util"
+)
+
+// Genesis describes the initial configuration of a chain. Every node of a
+// network must start from the same document; the Hash of the genesis
+// identifies it and is the parent of the first block.
+//
+//	{
+//	  "chainId": "swell-devnet",
+//	  "genesisTime": "2024-01-01T00:00:00Z",
+//	  "slotMilliseconds": 1000,
+//	  "epochSlots": 100,
+//	  "params": {"maxBlockBytes": 4194304, "maxBlockEvents": 65535, "maxEventSize": 32768, "maxValidators": 100},
+//	  "validators": [{"token": "<hex ed25519 public key>", "stake": 1000000}],
+//	  "appState": "<base64 initial application state>"
+//	}
+type Genesis struct {
+	ChainID          string          `json:"chainId"`
+	GenesisTime      time.Time       `json:"genesisTime"`
+	SlotMilliseconds uint64          `json:"slotMilliseconds"`
+	EpochSlots       uint64          `json:"epochSlots"`
+	Params           ConsensusParams `json:"params"`
+	Validators       []Validator     `json:"validators"`
+	AppState         []byte          `json:"appState"`
+}
+
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGenesis(data)
+}
+
+func ParseGenesis(data []byte) (*Genesis, error) {
+	genesis := Genesis{Params: DefaultConsensusParams}
+	if err := json.Unmarshal(data, &genesis); err != nil {
+		return nil, err
+	}
+	if err := genesis.Check(); err != nil {
+		return nil, err
+	}
+	return &genesis, nil
+}
+
+// Check verifies the consistency of the genesis parameters.
+func (g *Genesis) Check() error {
+	if g.ChainID == "" {
+		return errors.New("genesis without chain id")
+	}
+	if g.GenesisTime.IsZero() {
+		return errors.New("genesis without genesis time")
+	}
+	if g.SlotMilliseconds == 0 || g.EpochSlots == 0 {
+		return errors.New("genesis slot duration and epoch length must be positive")
+	}
+	if err := g.Params.Check(); err != nil {
+		return err
+	}
+	if len(g.Validators) == 0 || len(g.Validators) > 1<<16-1 {
+		return errors.New("genesis must have between 1 and 65535 validators")
+	}
+	tokens := make(map[crypto.Token]struct{})
+	total := uint64(0)
+	for _, validator := range g.Validators {
+		if validator.Stake == 0 {
+			return fmt.Errorf("genesis validator %v without stake", validator.Token)
+		}
+		if validator.Stake > MaxTotalStake-total {
+			return errors.New("genesis total stake overflows")
+		}
+		total += validator.Stake
+		if _, ok := tokens[validator.Token]; ok {
+			return fmt.Errorf("genesis validator %v repeated", validator.Token)
+		}
+		tokens[validator.Token] = struct{}{}
+	}
+	return nil
+}
+
+func (g *Genesis) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutString(g.ChainID, &bytes)
+	util.PutTime(g.GenesisTime.UTC(), &bytes)
+	util.PutUint64(g.SlotMilliseconds, &bytes)
+	util.PutUint64(g.EpochSlots, &bytes)
+	util.PutUint64(uint64(g.Params.MaxBlockBytes), &bytes)
+	util.PutUint64(uint64(g.Params.MaxBlockEvents), &bytes)
+	util.PutUint64(uint64(g.Params.MaxEventSize), &bytes)
+	util.PutUint64(uint64(g.Params.MaxValidators), &bytes)
+	util.PutUint16(uint16(len(g.Validators)), &bytes)
+	for _, validator := range g.Validators {
+		util.PutToken(validator.Token, &bytes)
+		util.PutUint64(validator.Stake, &bytes)
+	}
+	util.PutUint32(uint32(len(g.AppState)), &bytes)
+	return append(bytes, g.AppState...)
+}
+
+// Hash identifies the genesis. It is the hash of its canonical serialization.
+func (g *Genesis) Hash() crypto.Hash {
+	return crypto.Hasher(g.Serialize())
+}
+
+// Calendar returns the calendar of the slots and epochs of the chain.
+func (g *Genesis) Calendar() Calendar {
+	return NewCalendar(g.GenesisTime, time.Duration(g.SlotMilliseconds)*time.Millisecond, g.EpochSlots)
+}
+
+// BlockChain returns a new chain starting from the genesis, with state the
+// application state. A non empty AppState is restored into state as the
+// snapshot at clock 0.
+func (g *Genesis) BlockChain(state State) (*BlockChain, error) {
+	if len(g.AppState) > 0 {
+		if err := state.Restore(&Snapshot{Clock: 0, Data: g.AppState}); err != nil {
+			return nil, err
+		}
+	}
+	chain := BlockChain{
+		ChainID:         g.ChainID,
+		GenesisHash:     g.Hash(),
+		GenesisTime:     g.GenesisTime,
+		SlotDuration:    time.Duration(g.SlotMilliseconds) * time.Millisecond,
+		EpochSlots:      g.EpochSlots,
+		Params:          g.Params,
+		Epoch:           0,
+		Registry:        NewValidatorRegistry(g.Validators, g.Params.MaxValidators),
+		CurrentState:    state,
+		RecentBlocks:    make(SignedBlocks, 0),
+		CandidateBlocks: make(map[uint64]SignedBlocks),
+	}
+	set := chain.Registry.At(1)
+	chain.Validators, chain.TotalStake = set.Validators, set.TotalStake
+	return &chain, nil
+}
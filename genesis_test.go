@@ -0,0 +1,54 @@
+package swell
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+func TestParseGenesis(t *testing.T) {
+	token, _ := crypto.RandomAsymetricKey()
+	document := fmt.Sprintf(`{
+		"chainId": "swell-test",
+		"genesisTime": "2024-01-01T00:00:00Z",
+		"slotMilliseconds": 250,
+		"epochSlots": 100,
+		"validators": [{"token": "%v", "stake": 1000}, {"token": "%v", "stake": 500}],
+		"appState": "AQID"
+	}`, token, crypto.Token{1})
+	genesis, err := ParseGenesis([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesis.Validators[0].Token != token || string(genesis.AppState) != "\x01\x02\x03" {
+		t.Fatal("genesis not parsed correctly")
+	}
+	again, _ := ParseGenesis([]byte(document))
+	if genesis.Hash() != again.Hash() {
+		t.Fatal("genesis hash not deterministic")
+	}
+	again.Validators[1].Stake = 501
+	if genesis.Hash() == again.Hash() {
+		t.Fatal("genesis hash does not commit to stakes")
+	}
+	state := &bytesState{}
+	chain, err := genesis.BlockChain(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, _ := chain.Tip(); hash != genesis.Hash() || chain.TotalStake != 1500 {
+		t.Fatal("wrong chain from genesis")
+	}
+	if !bytes.Equal(state.data, genesis.AppState) {
+		t.Fatal("state not initialized from the genesis app state")
+	}
+	again.Validators[1].Stake = MaxTotalStake
+	if again.Check() == nil {
+		t.Fatal("genesis with overflowing total stake accepted")
+	}
+	if _, err := ParseGenesis([]byte(`{"chainId": "x", "genesisTime": "2024-01-01T00:00:00Z", "slotMilliseconds": 1, "epochSlots": 1}`)); err == nil {
+		t.Fatal("genesis without validators accepted")
+	}
+}
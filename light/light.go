@@ -0,0 +1,211 @@
+// Package light verifies finalized blocks without running a full node.
+//
+// A Client starts from a trusted validator set, usually the one of the
+// genesis, and checks that blocks and headers carry signatures of validators
+// holding more than two thirds of the stake. Events are verified against the
+// merkle root of a verified header with an EventProof. Validator set changes
+// are followed through ValidatorSetUpdate messages signed by a quorum of the
+// set they replace, collected from the swell.SetChange validators publish
+// with AddSetChange.
+package light
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/util"
+)
+
+var (
+	ErrInvalidHeader = errors.New("invalid block header")
+	ErrNoQuorum      = errors.New("signatures do not reach two thirds of the stake")
+	ErrStaleUpdate   = errors.New("validator set update older than current set")
+	ErrInvalidUpdate = errors.New("invalid validator set update")
+	ErrUnknownClock  = errors.New("no validator set known for clock")
+)
+
+// ValidatorSetUpdate replaces the validator set for blocks with clock
+// greater than or equal to Clock.
+type ValidatorSetUpdate struct {
+	Clock      uint64
+	Validators []swell.Validator
+}
+
+func (u *ValidatorSetUpdate) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(u.Clock, &bytes)
+	util.PutUint16(uint16(len(u.Validators)), &bytes)
+	for _, validator := range u.Validators {
+		util.PutToken(validator.Token, &bytes)
+		util.PutUint64(validator.Stake, &bytes)
+	}
+	return bytes
+}
+
+// Hash is the hash validators sign to approve the update, the hash of the
+// validator set.
+func (u *ValidatorSetUpdate) Hash() crypto.Hash {
+	return swell.NewValidatorSet(u.Clock, u.Validators).Hash()
+}
+
+func ParseValidatorSetUpdate(data []byte) *ValidatorSetUpdate {
+	position := 0
+	update := ValidatorSetUpdate{}
+	update.Clock, position = util.ParseUint64(data, position)
+	var count uint16
+	count, position = util.ParseUint16(data, position)
+	if position+int(count)*(crypto.TokenSize+8) != len(data) {
+		return nil
+	}
+	update.Validators = make([]swell.Validator, count)
+	for n := range update.Validators {
+		update.Validators[n].Token, position = util.ParseToken(data, position)
+		update.Validators[n].Stake, position = util.ParseUint64(data, position)
+	}
+	return &update
+}
+
+type Client struct {
+	mu      sync.RWMutex
+	sets    []*swell.ValidatorSet
+	pending map[crypto.Token]swell.Signature // set changes of the last set
+}
+
+// NewClient trusts validators for blocks from clock on.
+func NewClient(clock uint64, validators []swell.Validator) *Client {
+	return &Client{
+		sets:    []*swell.ValidatorSet{swell.NewValidatorSet(clock, validators)},
+		pending: make(map[crypto.Token]swell.Signature),
+	}
+}
+
+// NewGenesisClient trusts the validator set of genesis.
+func NewGenesisClient(genesis *swell.Genesis) *Client {
+	return NewClient(0, genesis.Validators)
+}
+
+// Validators returns the validator set in force at clock.
+func (c *Client) Validators(clock uint64) []swell.Validator {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if set := c.setAt(clock); set != nil {
+		return set.Validators
+	}
+	return nil
+}
+
+func (c *Client) setAt(clock uint64) *swell.ValidatorSet {
+	for n := len(c.sets) - 1; n >= 0; n-- {
+		if c.sets[n].Clock <= clock {
+			return c.sets[n]
+		}
+	}
+	return nil
+}
+
+func (c *Client) verify(clock uint64, hash crypto.Hash, signatures []swell.Signature) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	set := c.setAt(clock)
+	if set == nil {
+		return ErrUnknownClock
+	}
+	if !set.QuorumSigned(hash, signatures) {
+		return ErrNoQuorum
+	}
+	return nil
+}
+
+// VerifyHeader parses header, the bytes of Block.SerializeHeader, and checks
+// its publisher signature and that signatures of its commits at round reach
+// the quorum of the validator set in force at its clock. The returned block
+// has no events.
+func (c *Client) VerifyHeader(header []byte, round uint32, signatures []swell.Signature) (*swell.Block, error) {
+	block := swell.ParseBlockHeader(header)
+	if block == nil {
+		return nil, ErrInvalidHeader
+	}
+	if err := c.verify(block.Clock, swell.CommitHash(block.Hash(), round), signatures); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// VerifySignedBlock checks a full signed block as received from a node.
+func (c *Client) VerifySignedBlock(signed *swell.SignedBlock) error {
+	if signed == nil || signed.Block == nil {
+		return ErrInvalidHeader
+	}
+	if swell.ParseBlock(signed.Block.Serialize()) == nil {
+		return ErrInvalidHeader
+	}
+	return c.verify(signed.Block.Clock, signed.CommitHash(), signed.Signatures)
+}
+
+// VerifyEvent checks that event is included in the block of a header
+// returned by VerifyHeader.
+func VerifyEvent(header *swell.Block, event swell.Event, proof *swell.EventProof) bool {
+	return header != nil && proof != nil && proof.Verify(header.EventsRoot, event)
+}
+
+// Update replaces the validator set from update.Clock on, provided update is
+// signed by a quorum of the set in force at that clock and is newer than
+// every set known.
+func (c *Client) Update(update *ValidatorSetUpdate, signatures []swell.Signature) error {
+	if update == nil || len(update.Validators) == 0 {
+		return ErrInvalidUpdate
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := c.sets[len(c.sets)-1]
+	if update.Clock <= last.Clock {
+		return ErrStaleUpdate
+	}
+	if !last.QuorumSigned(update.Hash(), signatures) {
+		return ErrNoQuorum
+	}
+	c.sets = append(c.sets, swell.NewValidatorSet(update.Clock, update.Validators))
+	c.pending = make(map[crypto.Token]swell.Signature)
+	return nil
+}
+
+// AddSetChange collects a set change signed by a validator of the last set
+// known and applies its update once the changes collected reach the quorum
+// of that set. It returns ErrNoQuorum until they do. Only the next change is
+// signed by the last set, so the first change of each validator is kept.
+func (c *Client) AddSetChange(change *swell.SetChange) error {
+	if change == nil || change.Set == nil {
+		return ErrInvalidUpdate
+	}
+	update := &ValidatorSetUpdate{Clock: change.Set.Clock, Validators: change.Set.Validators}
+	c.mu.Lock()
+	signatures, err := c.collect(update, change.Signature)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.Update(update, signatures)
+}
+
+func (c *Client) collect(update *ValidatorSetUpdate, signature swell.Signature) ([]swell.Signature, error) {
+	last := c.sets[len(c.sets)-1]
+	if update.Clock <= last.Clock {
+		return nil, ErrStaleUpdate
+	}
+	hash := update.Hash()
+	if signature.Hash != hash || last.Stake(signature.Token) == 0 || !signature.Token.VerifyZIP215(hash[:], signature.Signature) {
+		return nil, ErrInvalidUpdate
+	}
+	if _, ok := c.pending[signature.Token]; !ok {
+		c.pending[signature.Token] = signature
+	}
+	signatures := make([]swell.Signature, 0)
+	for _, pending := range c.pending {
+		if pending.Hash == hash {
+			signatures = append(signatures, pending)
+		}
+	}
+	return signatures, nil
+}
@@ -0,0 +1,127 @@
+package light
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+type validatorKeys struct {
+	validators []swell.Validator
+	keys       []crypto.PrivateKey
+}
+
+func newValidators(count int) *validatorKeys {
+	v := &validatorKeys{}
+	for n := 0; n < count; n++ {
+		token, key := crypto.RandomAsymetricKey()
+		v.validators = append(v.validators, swell.Validator{Token: token, Stake: 10})
+		v.keys = append(v.keys, key)
+	}
+	return v
+}
+
+func (v *validatorKeys) sign(hash crypto.Hash, count int) []swell.Signature {
+	signatures := make([]swell.Signature, count)
+	for n := 0; n < count; n++ {
+		signatures[n] = swell.Signature{Hash: hash, Token: v.validators[n].Token, Signature: v.keys[n].Sign(hash[:])}
+	}
+	return signatures
+}
+
+func newBlock(clock uint64, key crypto.PrivateKey) *swell.Block {
+	block := &swell.Block{
+		Clock:       clock,
+		Publisher:   key.PublicKey(),
+		PublishedAt: time.Unix(int64(clock), 0),
+		Events:      swell.Events{{0, 1}, {0, 2}, {0, 3}},
+	}
+	block.Sign(key)
+	return block
+}
+
+func TestLightClient(t *testing.T) {
+	first := newValidators(4)
+	client := NewClient(0, first.validators)
+	block := newBlock(5, first.keys[0])
+	if _, err := client.VerifyHeader(block.SerializeHeader(), 0, first.sign(block.Hash(), 2)); err != ErrNoQuorum {
+		t.Fatalf("header with half of the stake accepted: %v", err)
+	}
+	header, err := client.VerifyHeader(block.SerializeHeader(), 0, first.sign(block.Hash(), 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.VerifyHeader(block.SerializeHeader(), 2, first.sign(block.Hash(), 3)); err != ErrNoQuorum {
+		t.Fatalf("commits of another round accepted: %v", err)
+	}
+	if _, err := client.VerifyHeader(block.SerializeHeader(), 2, first.sign(swell.CommitHash(block.Hash(), 2), 3)); err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyEvent(header, block.Events[2], block.EventProof(2)) || VerifyEvent(header, block.Events[1], block.EventProof(2)) {
+		t.Error("wrong event inclusion check")
+	}
+
+	second := newValidators(3)
+	update := &ValidatorSetUpdate{Clock: 10, Validators: second.validators}
+	if err := client.Update(update, second.sign(update.Hash(), 3)); err != ErrNoQuorum {
+		t.Fatalf("update signed by the new set accepted: %v", err)
+	}
+	if err := client.Update(ParseValidatorSetUpdate(update.Serialize()), first.sign(update.Hash(), 3)); err != nil {
+		t.Fatal(err)
+	}
+	later := &swell.SignedBlock{Block: newBlock(12, second.keys[0])}
+	later.Signatures = first.sign(later.Block.Hash(), 4)
+	if err := client.VerifySignedBlock(later); err != ErrNoQuorum {
+		t.Errorf("block signed by the replaced set accepted: %v", err)
+	}
+	later.Signatures = second.sign(later.Block.Hash(), 3)
+	if err := client.VerifySignedBlock(later); err != nil {
+		t.Errorf("block signed by the new set rejected: %v", err)
+	}
+	if _, err := client.VerifyHeader(block.SerializeHeader(), 0, first.sign(block.Hash(), 3)); err != nil {
+		t.Errorf("old header no longer verifies: %v", err)
+	}
+}
+
+func TestFollowSetChanges(t *testing.T) {
+	first := newValidators(4)
+	chain := &swell.BlockChain{Registry: swell.NewValidatorRegistry(first.validators, 0)}
+	if chain.SetChange(4, first.keys[0]) != nil {
+		t.Fatal("set change without a change")
+	}
+	_, joined := crypto.RandomAsymetricKey()
+	if err := chain.Registry.Deposit(5, joined.PublicKey(), 20); err != nil {
+		t.Fatal(err)
+	}
+	if chain.SetChange(5, joined) != nil {
+		t.Fatal("set change signed by a validator of the new set only")
+	}
+	client := NewClient(0, first.validators)
+	for n, key := range first.keys[:3] {
+		change := chain.SetChange(5, key)
+		if change == nil || change.Set.Clock != 6 {
+			t.Fatal("no set change after the deposit")
+		}
+		forged := *change
+		forged.Set = swell.NewValidatorSet(6, first.validators[:1])
+		if err := client.AddSetChange(&forged); err != ErrInvalidUpdate {
+			t.Fatalf("forged set change accepted: %v", err)
+		}
+		if err := client.AddSetChange(change); n < 2 && err != ErrNoQuorum || n == 2 && err != nil {
+			t.Fatalf("unexpected result %v of set change %v", err, n)
+		}
+	}
+	// the joined validator is needed for the quorum of the new set
+	block := newBlock(6, joined)
+	hash := block.Hash()
+	signed := &swell.SignedBlock{Block: block, Signatures: first.sign(hash, 3)}
+	if err := client.VerifySignedBlock(signed); err != ErrNoQuorum {
+		t.Fatalf("block without the quorum of the new set accepted: %v", err)
+	}
+	signed.Signatures = append(signed.Signatures, swell.Signature{Hash: hash, Token: joined.PublicKey(), Signature: joined.Sign(hash[:])})
+	if err := client.VerifySignedBlock(signed); err != nil {
+		t.Fatalf("block of the new set rejected: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package swell
+
+import (
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/util"
+)
+
+// Events of a block are committed by a binary merkle tree. Leaves and inner
+// nodes are domain separated by a prefix byte so that an inner node can never
+// be presented as an event. A node without a sibling on its level is promoted
+// unchanged to the level above. The root of the tree is hashed together with
+// the number of events, so that a proof is bound to its position and count.
+// The root of an empty list is crypto.ZeroHash.
+
+const (
+	merkleLeafPrefix  byte = 0
+	merkleNodePrefix  byte = 1
+	merkleCountPrefix byte = 2
+)
+
+func merkleLeaf(event Event) crypto.Hash {
+	return crypto.Hasher(append([]byte{merkleLeafPrefix}, event...))
+}
+
+func merkleNode(left, right crypto.Hash) crypto.Hash {
+	data := make([]byte, 0, 2*crypto.Size+1)
+	data = append(data, merkleNodePrefix)
+	data = append(data, left[:]...)
+	data = append(data, right[:]...)
+	return crypto.Hasher(data)
+}
+
+func merkleCount(count uint16, top crypto.Hash) crypto.Hash {
+	data := []byte{merkleCountPrefix}
+	util.PutUint16(count, &data)
+	util.PutHash(top, &data)
+	return crypto.Hasher(data)
+}
+
+func merkleLevel(nodes []crypto.Hash) []crypto.Hash {
+	next := make([]crypto.Hash, (len(nodes)+1)/2)
+	for n := 0; n < len(nodes)/2; n++ {
+		next[n] = merkleNode(nodes[2*n], nodes[2*n+1])
+	}
+	if len(nodes)%2 == 1 {
+		next[len(next)-1] = nodes[len(nodes)-1]
+	}
+	return next
+}
+
+func MerkleRoot(events Events) crypto.Hash {
+	if len(events) == 0 {
+		return crypto.ZeroHash
+	}
+	nodes := make([]crypto.Hash, len(events))
+	for n, event := range events {
+		nodes[n] = merkleLeaf(event)
+	}
+	for len(nodes) > 1 {
+		nodes = merkleLevel(nodes)
+	}
+	return merkleCount(uint16(len(events)), nodes[0])
+}
+
+// EventProof proves the inclusion of the event at position Index of a block
+// with Count events. Path holds the siblings from the leaf up to the root.
+type EventProof struct {
+	Index uint16
+	Count uint16
+	Path  []crypto.Hash
+}
+
+// EventProof returns the inclusion proof for the event at position index, or
+// nil if there is no such event.
+func (b *Block) EventProof(index int) *EventProof {
+	if index < 0 || index >= len(b.Events) {
+		return nil
+	}
+	proof := EventProof{Index: uint16(index), Count: uint16(len(b.Events)), Path: make([]crypto.Hash, 0)}
+	nodes := make([]crypto.Hash, len(b.Events))
+	for n, event := range b.Events {
+		nodes[n] = merkleLeaf(event)
+	}
+	for position := index; len(nodes) > 1; position = position / 2 {
+		if sibling := position ^ 1; sibling < len(nodes) {
+			proof.Path = append(proof.Path, nodes[sibling])
+		}
+		nodes = merkleLevel(nodes)
+	}
+	return &proof
+}
+
+// Verify checks that event is committed at the proof position by the merkle
+// root (the EventsRoot of a block header).
+func (p *EventProof) Verify(root crypto.Hash, event Event) bool {
+	if p.Index >= p.Count {
+		return false
+	}
+	hash := merkleLeaf(event)
+	position, width, step := int(p.Index), int(p.Count), 0
+	for ; width > 1; width = (width + 1) / 2 {
+		sibling := position ^ 1
+		if sibling < width {
+			if step >= len(p.Path) {
+				return false
+			}
+			if position%2 == 0 {
+				hash = merkleNode(hash, p.Path[step])
+			} else {
+				hash = merkleNode(p.Path[step], hash)
+			}
+			step += 1
+		}
+		position = position / 2
+	}
+	return step == len(p.Path) && merkleCount(p.Count, hash) == root
+}
+
+func (p *EventProof) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint16(p.Index, &bytes)
+	util.PutUint16(p.Count, &bytes)
+	util.PutUint16(uint16(len(p.Path)), &bytes)
+	for _, hash := range p.Path {
+		util.PutHash(hash, &bytes)
+	}
+	return bytes
+}
+
+func ParseEventProof(data []byte) *EventProof {
+	proof := EventProof{}
+	position := 0
+	var length uint16
+	proof.Index, position = util.ParseUint16(data, position)
+	proof.Count, position = util.ParseUint16(data, position)
+	length, position = util.ParseUint16(data, position)
+	if position+int(length)*crypto.Size != len(data) {
+		return nil
+	}
+	proof.Path = make([]crypto.Hash, length)
+	for n := 0; n < int(length); n++ {
+		proof.Path[n], position = util.ParseHash(data, position)
+	}
+	return &proof
+}
@@ -0,0 +1,67 @@
+package swell
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+func TestEventProof(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	for count := 1; count <= 17; count++ {
+		block := &Block{Clock: 1, Publisher: key.PublicKey(), PublishedAt: time.Now()}
+		for n := 0; n < count; n++ {
+			block.Events = append(block.Events, Event{0, byte(n), byte(count)})
+		}
+		block.Sign(key)
+		header := ParseBlockHeader(block.SerializeHeader())
+		if header == nil || header.Hash() != block.Hash() {
+			t.Fatalf("could not parse header of block with %v events", count)
+		}
+		for n := 0; n < count; n++ {
+			proof := ParseEventProof(block.EventProof(n).Serialize())
+			if proof == nil || !proof.Verify(header.EventsRoot, block.Events[n]) {
+				t.Fatalf("valid proof of event %v of %v rejected", n, count)
+			}
+			if proof.Verify(header.EventsRoot, Event{1, 2, 3}) {
+				t.Fatalf("proof of foreign event accepted")
+			}
+			if count > 1 {
+				proof.Index = uint16((n + 1) % count)
+				if proof.Verify(header.EventsRoot, block.Events[n]) {
+					t.Fatalf("proof with wrong index accepted")
+				}
+			}
+		}
+	}
+}
+
+func TestEventProofBindsCount(t *testing.T) {
+	events := Events{Event{0, 1}, Event{0, 2}, Event{0, 3}}
+	block := &Block{Events: events}
+	proof := block.EventProof(2)
+	root := MerkleRoot(events)
+	if !proof.Verify(root, events[2]) {
+		t.Fatal("valid proof rejected")
+	}
+	// the odd leaf is promoted: without the count the proof also fits index 1
+	// of a block with two events
+	proof.Index, proof.Count = 1, 2
+	if proof.Verify(root, events[2]) {
+		t.Fatal("proof with wrong count accepted")
+	}
+}
+
+func TestParseBlockRejectsTamperedEvents(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	block := &Block{Clock: 1, Publisher: key.PublicKey(), PublishedAt: time.Now(), Events: Events{Event{0, 1}, Event{0, 2}}}
+	block.Sign(key)
+	if ParseBlock(block.Serialize()) == nil {
+		t.Fatal("valid block rejected")
+	}
+	block.Events[1] = Event{0, 3}
+	if ParseBlock(block.Serialize()) != nil {
+		t.Fatal("block with events not matching the signed root accepted")
+	}
+}
@@ -1,7 +1,7 @@
 package swell
 
 import (
-	"time"
+	"runtime"
 
 	"github.com/lienkolabs/swell/crypto"
 )
@@ -11,16 +11,20 @@ type PeerRequest struct {
 	Response chan bool
 }
 
-type Checksum struct {
-	Token   crypto.Hash
-	Check   []byte
-	Confirm chan bool
-}
+const (
+	SyncManifest byte = iota // request the snapshot manifest
+	SyncChunk                // request the snapshot chunk at Index
+	SyncBlocks               // request the blocks after Clock
+)
 
+// SyncRequest is a request of a syncing peer. Clock is the clock of the
+// snapshot being downloaded. The node sends the serialized manifest, chunk or
+// blocks on Response, or nil if it cannot serve the request.
 type SyncRequest struct {
-	Starting chan uint64
-	Data     chan []byte
-	Ok       chan bool
+	Kind     byte
+	Clock    uint64
+	Index    uint32
+	Response chan []byte
 }
 
 type ValidatedConnection struct {
@@ -28,46 +32,82 @@ type ValidatedConnection struct {
 	Ok    chan bool
 }
 
+// outboundBuffer is the capacity of the channels on which the node publishes
+// so that the consensus engine is not held by a slow network.
+const outboundBuffer = 64
+
 type Communication struct {
-	PeerRequest     chan *PeerRequest // Node receives new peer requests from network
-	NewBlock        chan *Block       // Node publishes to or receives new blocks from the network
-	BlockSignature  chan *Signature   // Node publishes to or receives signatures from the network
-	Checkpoint      chan *SignedBlock // Node publishes new checkpoint to observers network
-	Checksum        chan *Checksum    // Node publishes to or receives checksums from the network
-	Synchronization chan SyncRequest  // Node receives sync request
-	ValidateConn    chan ValidatedConnection
-	Events          chan Event
+	PeerRequest       chan *PeerRequest          // Node receives new peer requests from network
+	NewBlock          chan *Block                // Node publishes new blocks to the network
+	IncomingBlock     chan *Block                // Node receives new blocks from the network
+	BlockSignature    chan *Signature            // Node publishes signatures to the network
+	IncomingSignature chan *Signature            // Node receives signatures from the network
+	Checkpoint        chan *SignedBlock          // Node publishes new checkpoint to observers network
+	SetChange         chan *SetChange            // Node publishes its signature of a new validator set
+	Checksum          chan *StateChecksum        // Node publishes its checksum at the end of a window
+	IncomingChecksum  chan *StateChecksum        // Node receives checksums from the network
+	ChecksumDiverged  chan *ChecksumDenunciation // Node publishes that its checksum diverged
+	Synchronization   chan SyncRequest           // Node receives sync request
+	Evidence          chan *Evidence             // Node publishes evidence of equivocation
+	IncomingEvidence  chan *Evidence             // Node receives evidence of equivocation
+	Proposal          chan *Proposal             // Node publishes proposals of round based engines
+	IncomingProposal  chan *Proposal             // Node receives proposals of round based engines
+	Vote              chan *Vote                 // Node publishes votes of round based engines
+	IncomingVote      chan *Vote                 // Node receives votes of round based engines
+	Halted            chan error                 // Node publishes the error that stopped the engine
+	ValidateConn      chan ValidatedConnection
+	Events            chan Event   // Node receives events to include in blocks
+	IncomingEvent     chan<- Event // Node receives events from the network, verified into Events
+	verifier          *EventVerifier
 }
 
 func NewCommunication() *Communication {
+	events := make(chan Event)
+	verifier := NewEventVerifier(runtime.NumCPU(), events)
 	return &Communication{
-		PeerRequest:     make(chan *PeerRequest),
-		NewBlock:        make(chan *Block),
-		BlockSignature:  make(chan *Signature),
-		Checkpoint:      make(chan *SignedBlock),
-		Checksum:        make(chan *Checksum),
-		Synchronization: make(chan SyncRequest),
-		ValidateConn:    make(chan ValidatedConnection),
-		Events:          make(chan Event),
+		PeerRequest:       make(chan *PeerRequest),
+		NewBlock:          make(chan *Block, outboundBuffer),
+		IncomingBlock:     make(chan *Block),
+		BlockSignature:    make(chan *Signature, outboundBuffer),
+		IncomingSignature: make(chan *Signature),
+		Checkpoint:        make(chan *SignedBlock, outboundBuffer),
+		SetChange:         make(chan *SetChange, outboundBuffer),
+		Checksum:          make(chan *StateChecksum, outboundBuffer),
+		IncomingChecksum:  make(chan *StateChecksum),
+		ChecksumDiverged:  make(chan *ChecksumDenunciation, outboundBuffer),
+		Synchronization:   make(chan SyncRequest),
+		Evidence:          make(chan *Evidence, outboundBuffer),
+		IncomingEvidence:  make(chan *Evidence),
+		Proposal:          make(chan *Proposal, outboundBuffer),
+		IncomingProposal:  make(chan *Proposal),
+		Vote:              make(chan *Vote, outboundBuffer),
+		IncomingVote:      make(chan *Vote),
+		Halted:            make(chan error, 1),
+		ValidateConn:      make(chan ValidatedConnection),
+		Events:            events,
+		IncomingEvent:     verifier.Input(),
+		verifier:          verifier,
 	}
 }
 
-type ConsensusEngine func(BlockChain) *Communication
-
-func IntervalToNewEpoch(epoch uint64, genesis time.Time) time.Duration {
-	return time.Until(genesis.Add(time.Duration(int64(epoch) * 1000000000)))
+// Close stops the verification of the events received on IncomingEvent.
+// Engines call it once they halted and no longer read Events.
+func (c *Communication) Close() {
+	c.verifier.Stop()
 }
 
-func LauchNewGenesisConsensus(egine ConsensusEngine) {
-	//pool := NewInstructionPool()
+// ConsensusEngine starts consensus over chain on behalf of the validator key
+// and returns the channels through which it talks to the network.
+type ConsensusEngine func(chain *BlockChain, key crypto.PrivateKey) *Communication
 
-	//processInstruction := make(chan instructions.Instruction)
-	go func() {
-		for {
-			select {
-			//case newInstruction := <-processInstruction:
-			//pool.Queue(newInstruction)
-			}
-		}
-	}()
+// LauchNewGenesisConsensus starts engine over a chain that has not yet
+// produced any block.
+func LauchNewGenesisConsensus(engine ConsensusEngine, chain *BlockChain, key crypto.PrivateKey) *Communication {
+	if chain.CandidateBlocks == nil {
+		chain.CandidateBlocks = make(map[uint64]SignedBlocks)
+	}
+	if chain.RecentBlocks == nil {
+		chain.RecentBlocks = make(SignedBlocks, 0)
+	}
+	return engine(chain, key)
 }
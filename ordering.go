@@ -0,0 +1,253 @@
+package swell
+
+import (
+	"container/heap"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// OrderingPolicy decides the order in which events leave an EventsPool. The
+// pool calls it while holding its lock, so implementations need no locking of
+// their own. Remove is only called for entries pushed and not yet popped.
+// Peek returns the entry Pop would return without removing it.
+type OrderingPolicy interface {
+	Push(entry *PoolEntry)
+	Pop() *PoolEntry
+	Peek() *PoolEntry
+	Remove(entry *PoolEntry)
+	Len() int
+}
+
+// FeeFunc extracts the fee offered by an event.
+type FeeFunc func(Event) uint64
+
+// SenderFunc extracts the author of an event.
+type SenderFunc func(Event) crypto.Token
+
+// entryList is a doubly linked list of entries in arrival order.
+type entryList struct {
+	first, last *PoolEntry
+	length      int
+}
+
+func (l *entryList) push(entry *PoolEntry) {
+	entry.prev, entry.next = l.last, nil
+	if l.last != nil {
+		l.last.next = entry
+	} else {
+		l.first = entry
+	}
+	l.last = entry
+	l.length += 1
+}
+
+func (l *entryList) remove(entry *PoolEntry) {
+	if entry.prev != nil {
+		entry.prev.next = entry.next
+	} else {
+		l.first = entry.next
+	}
+	if entry.next != nil {
+		entry.next.prev = entry.prev
+	} else {
+		l.last = entry.prev
+	}
+	entry.prev, entry.next = nil, nil
+	l.length -= 1
+}
+
+func (l *entryList) pop() *PoolEntry {
+	entry := l.first
+	if entry != nil {
+		l.remove(entry)
+	}
+	return entry
+}
+
+// FIFOPolicy releases events in the order they were received.
+type FIFOPolicy struct {
+	list entryList
+}
+
+func NewFIFOPolicy() *FIFOPolicy {
+	return &FIFOPolicy{}
+}
+
+func (p *FIFOPolicy) Push(entry *PoolEntry) {
+	p.list.push(entry)
+}
+
+func (p *FIFOPolicy) Pop() *PoolEntry {
+	return p.list.pop()
+}
+
+func (p *FIFOPolicy) Peek() *PoolEntry {
+	return p.list.first
+}
+
+func (p *FIFOPolicy) Remove(entry *PoolEntry) {
+	p.list.remove(entry)
+}
+
+func (p *FIFOPolicy) Len() int {
+	return p.list.length
+}
+
+// FeePolicy releases events with the highest fee first. Events offering the
+// same fee leave in the order they were received.
+type FeePolicy struct {
+	fee     FeeFunc
+	entries feeHeap
+}
+
+func NewFeePolicy(fee FeeFunc) *FeePolicy {
+	return &FeePolicy{fee: fee, entries: make(feeHeap, 0)}
+}
+
+func (p *FeePolicy) Push(entry *PoolEntry) {
+	entry.priority = p.fee(entry.Event)
+	heap.Push(&p.entries, entry)
+}
+
+func (p *FeePolicy) Pop() *PoolEntry {
+	if len(p.entries) == 0 {
+		return nil
+	}
+	return heap.Pop(&p.entries).(*PoolEntry)
+}
+
+func (p *FeePolicy) Peek() *PoolEntry {
+	if len(p.entries) == 0 {
+		return nil
+	}
+	return p.entries[0]
+}
+
+func (p *FeePolicy) Remove(entry *PoolEntry) {
+	heap.Remove(&p.entries, entry.index)
+}
+
+func (p *FeePolicy) Len() int {
+	return len(p.entries)
+}
+
+type feeHeap []*PoolEntry
+
+func (h feeHeap) Len() int {
+	return len(h)
+}
+
+func (h feeHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].Sequence < h[j].Sequence
+}
+
+func (h feeHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *feeHeap) Push(x any) {
+	entry := x.(*PoolEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *feeHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	entry.index = -1
+	return entry
+}
+
+// FairPolicy releases events round-robin among senders, so that a single
+// sender flooding the pool cannot delay the events of everyone else. Events
+// of the same sender leave in the order they were received.
+type FairPolicy struct {
+	sender  SenderFunc
+	queues  map[crypto.Token]*senderQueue
+	current *senderQueue // next sender to be served, nil if empty
+	length  int
+}
+
+type senderQueue struct {
+	token      crypto.Token
+	list       entryList
+	prev, next *senderQueue // circular ring of senders with pending events
+}
+
+func NewFairPolicy(sender SenderFunc) *FairPolicy {
+	return &FairPolicy{sender: sender, queues: make(map[crypto.Token]*senderQueue)}
+}
+
+func (p *FairPolicy) Push(entry *PoolEntry) {
+	token := p.sender(entry.Event)
+	queue, ok := p.queues[token]
+	if !ok {
+		queue = &senderQueue{token: token}
+		p.queues[token] = queue
+		if p.current == nil {
+			queue.prev, queue.next = queue, queue
+			p.current = queue
+		} else {
+			// new senders are served last in the current round
+			queue.prev, queue.next = p.current.prev, p.current
+			p.current.prev.next = queue
+			p.current.prev = queue
+		}
+	}
+	queue.list.push(entry)
+	p.length += 1
+}
+
+func (p *FairPolicy) Pop() *PoolEntry {
+	if p.current == nil {
+		return nil
+	}
+	queue := p.current
+	entry := queue.list.pop()
+	p.length -= 1
+	p.current = queue.next
+	if queue.list.length == 0 {
+		p.drop(queue)
+	}
+	return entry
+}
+
+func (p *FairPolicy) Peek() *PoolEntry {
+	if p.current == nil {
+		return nil
+	}
+	return p.current.list.first
+}
+
+func (p *FairPolicy) Remove(entry *PoolEntry) {
+	queue := p.queues[p.sender(entry.Event)]
+	queue.list.remove(entry)
+	p.length -= 1
+	if queue.list.length == 0 {
+		p.drop(queue)
+	}
+}
+
+func (p *FairPolicy) drop(queue *senderQueue) {
+	delete(p.queues, queue.token)
+	if queue.next == queue {
+		p.current = nil
+		return
+	}
+	queue.prev.next = queue.next
+	queue.next.prev = queue.prev
+	if p.current == queue {
+		p.current = queue.next
+	}
+}
+
+func (p *FairPolicy) Len() int {
+	return p.length
+}
@@ -105,7 +105,7 @@ func PerformClientHandShake(conn net.Conn, prvKey crypto.PrivateKey, remotePub c
 	}
 	var sign crypto.Signature
 	copy(sign[:], respSign)
-	if !remotePub.Verify(resp, sign) {
+	if !remotePub.VerifyZIP215(resp, sign) {
 		return nil, errors.New("client: signature does not match")
 	}
 	// calculate diffie hellman shared secret
@@ -168,7 +168,7 @@ func PerformServerHandShake(conn net.Conn, prvKey crypto.PrivateKey, validator V
 	}
 	var sign crypto.Signature
 	copy(sign[:], respSign)
-	if !remoteToken.Verify(resp, sign) {
+	if !remoteToken.VerifyZIP215(resp, sign) {
 		return nil, errors.New("server: signature does not match")
 	}
 	return &SecureConnection{
@@ -1,8 +1,6 @@
 package p2p
 
 import (
-	"time"
-
 	"github.com/lienkolabs/swell"
 	"github.com/lienkolabs/swell/crypto"
 )
@@ -15,9 +13,6 @@ const (
 	syncPort                       = 7804
 )
 
-var BlockWindow, _ = time.ParseDuration("1s")
-var GenesisTime = time.Date(2021, time.November, 18, 0, 0, 0, 0, time.UTC)
-
 type MsgValidator struct {
 	msg []byte
 	ok  chan bool
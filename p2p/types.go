@@ -3,6 +3,7 @@ package p2p
 import (
 	"time"
 
+	"github.com/lienkolabs/swell"
 	"github.com/lienkolabs/swell/crypto"
 	"github.com/lienkolabs/swell/util"
 )
@@ -26,6 +27,8 @@ const (
 	IChecksumBrodcast
 	IDenounceChecksum
 	IDropFromPool
+	IProposal
+	IVote
 )
 
 type Serializer interface {
@@ -76,36 +79,101 @@ func (msg *NetworkMessageTemplate) Serialize() []byte {
 	return output
 }
 
-type SyncRequest struct{}
+// SyncRequest asks a peer for the manifest, a chunk or the blocks after the
+// snapshot at Clock (see swell.SyncRequest).
+type SyncRequest struct {
+	Resource byte // swell.SyncManifest, swell.SyncChunk or swell.SyncBlocks
+	Clock    uint64
+	Index    uint32
+}
 
 func (s *SyncRequest) Serialize() []byte {
-	return []byte{}
+	bytes := []byte{s.Resource}
+	util.PutUint64(s.Clock, &bytes)
+	util.PutUint32(s.Index, &bytes)
+	return bytes
 }
 
 func (s *SyncRequest) Kind() byte {
 	return ISyncRequest
 }
 
-type ResumeSync struct{}
+func ParseSyncRequest(data []byte) *SyncRequest {
+	if len(data) != 13 {
+		return nil
+	}
+	request := SyncRequest{Resource: data[0]}
+	request.Clock, _ = util.ParseUint64(data, 1)
+	request.Index, _ = util.ParseUint32(data, 9)
+	return &request
+}
+
+// ResumeSync asks a peer for the chunks still missing of the snapshot at
+// Clock after a disconnection.
+type ResumeSync struct {
+	Clock   uint64
+	Missing []uint32
+}
 
 func (s *ResumeSync) Serialize() []byte {
-	return []byte{}
+	bytes := make([]byte, 0)
+	util.PutUint64(s.Clock, &bytes)
+	util.PutUint32(uint32(len(s.Missing)), &bytes)
+	for _, index := range s.Missing {
+		util.PutUint32(index, &bytes)
+	}
+	return bytes
 }
 
 func (s *ResumeSync) Kind() byte {
 	return IResumeSyncRequest
 }
 
-type SyncResponse struct{}
+func ParseResumeSync(data []byte) *ResumeSync {
+	resume := ResumeSync{}
+	position := 0
+	var count uint32
+	resume.Clock, position = util.ParseUint64(data, position)
+	count, position = util.ParseUint32(data, position)
+	if position+4*int(count) != len(data) {
+		return nil
+	}
+	resume.Missing = make([]uint32, count)
+	for n := 0; n < int(count); n++ {
+		resume.Missing[n], position = util.ParseUint32(data, position)
+	}
+	return &resume
+}
+
+// SyncResponse carries the answer to a SyncRequest. An empty Data means the
+// peer cannot serve the request.
+type SyncResponse struct {
+	Request SyncRequest
+	Data    []byte
+}
 
 func (s *SyncResponse) Serialize() []byte {
-	return []byte{}
+	bytes := s.Request.Serialize()
+	util.PutUint32(uint32(len(s.Data)), &bytes)
+	return append(bytes, s.Data...)
 }
 
 func (s *SyncResponse) Kind() byte {
 	return ISyncResponse
 }
 
+func ParseSyncResponse(data []byte) *SyncResponse {
+	if len(data) < 17 {
+		return nil
+	}
+	request := ParseSyncRequest(data[0:13])
+	length, position := util.ParseUint32(data, 13)
+	if request == nil || position+int(length) != len(data) {
+		return nil
+	}
+	return &SyncResponse{Request: *request, Data: data[position:]}
+}
+
 type BlockListenerRequest struct{}
 
 func (s *BlockListenerRequest) Serialize() []byte {
@@ -209,16 +277,26 @@ func (s *BlockValidation) Kind() byte {
 	return IBlockValidation
 }
 
-type DenounceCheckpoint struct{}
+// DenounceCheckpoint carries the serialized evidence of an equivocation (see
+// swell.Evidence).
+type DenounceCheckpoint struct {
+	Evidence []byte
+}
 
 func (s *DenounceCheckpoint) Serialize() []byte {
-	return []byte{}
+	return s.Evidence
 }
 
 func (s *DenounceCheckpoint) Kind() byte {
 	return IDenounceCheckpoint
 }
 
+// ParseDenounceCheckpoint returns the evidence of a denounce message if it is
+// valid.
+func ParseDenounceCheckpoint(data []byte) *swell.Evidence {
+	return swell.ParseEvidence(data)
+}
+
 type ChecksumReceive struct{}
 
 func (s *ChecksumReceive) Serialize() []byte {
@@ -229,20 +307,26 @@ func (s *ChecksumReceive) Kind() byte {
 	return IChecksumReceive
 }
 
-type ChecksumBrodcast struct{}
+// ChecksumBrodcast carries a serialized swell.StateChecksum.
+type ChecksumBrodcast struct {
+	Checksum []byte
+}
 
 func (s *ChecksumBrodcast) Serialize() []byte {
-	return []byte{}
+	return s.Checksum
 }
 
 func (s *ChecksumBrodcast) Kind() byte {
 	return IChecksumBrodcast
 }
 
-type DenounceChecksum struct{}
+// DenounceChecksum carries a serialized swell.ChecksumDenunciation.
+type DenounceChecksum struct {
+	Denunciation []byte
+}
 
 func (s *DenounceChecksum) Serialize() []byte {
-	return []byte{}
+	return s.Denunciation
 }
 
 func (s *DenounceChecksum) Kind() byte {
@@ -258,3 +342,29 @@ func (s *DropFromPool) Serialize() []byte {
 func (s *DropFromPool) Kind() byte {
 	return IDropFromPool
 }
+
+// Proposal carries a serialized swell.Proposal of a round based engine.
+type Proposal struct {
+	Proposal []byte
+}
+
+func (s *Proposal) Serialize() []byte {
+	return s.Proposal
+}
+
+func (s *Proposal) Kind() byte {
+	return IProposal
+}
+
+// Vote carries a serialized swell.Vote of a round based engine.
+type Vote struct {
+	Vote []byte
+}
+
+func (s *Vote) Serialize() []byte {
+	return s.Vote
+}
+
+func (s *Vote) Kind() byte {
+	return IVote
+}
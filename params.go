@@ -0,0 +1,80 @@
+package swell
+
+import "errors"
+
+// ConsensusParams bound the blocks a slot can produce so that every block
+// can be transmitted to and validated by every peer. Zero limits are replaced
+// by the ones of DefaultConsensusParams.
+type ConsensusParams struct {
+	MaxBlockBytes  int `json:"maxBlockBytes"`  // size of the serialized block
+	MaxBlockEvents int `json:"maxBlockEvents"` // number of events of a block
+	MaxEventSize   int `json:"maxEventSize"`   // size of a single event
+	MaxValidators  int `json:"maxValidators"`  // active validators, zero for no limit
+}
+
+// Events are serialized with a uint16 length and a block with a uint16 count
+// of events, so no parameter can exceed these limits.
+const (
+	maxSerializedEvents    = 1<<16 - 1
+	maxSerializedEventSize = 1<<16 - 1
+)
+
+var DefaultConsensusParams = ConsensusParams{
+	MaxBlockBytes:  1 << 22,
+	MaxBlockEvents: maxSerializedEvents,
+	MaxEventSize:   1 << 15,
+}
+
+// WithDefaults returns params with zero limits replaced by the defaults.
+func (p ConsensusParams) WithDefaults() ConsensusParams {
+	if p.MaxBlockBytes == 0 {
+		p.MaxBlockBytes = DefaultConsensusParams.MaxBlockBytes
+	}
+	if p.MaxBlockEvents == 0 {
+		p.MaxBlockEvents = DefaultConsensusParams.MaxBlockEvents
+	}
+	if p.MaxEventSize == 0 {
+		p.MaxEventSize = DefaultConsensusParams.MaxEventSize
+	}
+	return p
+}
+
+func (p ConsensusParams) Check() error {
+	p = p.WithDefaults()
+	if p.MaxBlockEvents <= 0 || p.MaxBlockEvents > maxSerializedEvents {
+		return errors.New("max block events must be between 1 and 65535")
+	}
+	if p.MaxEventSize <= 0 || p.MaxEventSize > maxSerializedEventSize {
+		return errors.New("max event size must be between 1 and 65535")
+	}
+	if p.MaxValidators < 0 {
+		return errors.New("max validators cannot be negative")
+	}
+	if p.MaxBlockBytes < p.MaxEventSize {
+		return errors.New("max block bytes must be at least the max event size")
+	}
+	return nil
+}
+
+// Size returns the length of the serialized block.
+func (b *Block) Size() int {
+	size := len(b.SerializeHeader()) + 2
+	for _, event := range b.Events {
+		size += 2 + len(event)
+	}
+	return size
+}
+
+// CheckLimits checks that block respects params.
+func (p ConsensusParams) CheckLimits(block *Block) bool {
+	p = p.WithDefaults()
+	if len(block.Events) > p.MaxBlockEvents {
+		return false
+	}
+	for _, event := range block.Events {
+		if len(event) > p.MaxEventSize {
+			return false
+		}
+	}
+	return block.Size() <= p.MaxBlockBytes
+}
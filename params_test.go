@@ -0,0 +1,103 @@
+package swell
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+func TestBlockLimits(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	params := ConsensusParams{MaxBlockBytes: 400, MaxBlockEvents: 3, MaxEventSize: 100}
+	if err := params.Check(); err != nil {
+		t.Fatal(err)
+	}
+	pool := NewInstructionPool()
+	oversized := append(newEvent(1, 0), make([]byte, 200)...)
+	pool.Queue(oversized, oversized.Hash())
+	for n := 0; n < 5; n++ {
+		event := newEvent(1, byte(n))
+		pool.Queue(event, event.Hash())
+	}
+	state := &bytesState{}
+	built := BlockBuilder(crypto.ZeroHash, 0, 1, token, time.Now().Add(100*time.Millisecond), pool, state.Overlay(nil, 1), params, SystemTime)
+	build := <-built
+	if pool.Len() != 6 {
+		t.Fatal("events taken from the pool outside the engine goroutine")
+	}
+	block := build()
+	block.Sign(key)
+	if len(block.Events) != 3 || block.Size() != len(block.Serialize()) {
+		t.Fatalf("builder ignored limits: %v events", len(block.Events))
+	}
+	if pool.Len() != 2 {
+		t.Errorf("oversized event should be dropped and the rest kept, pool has %v", pool.Len())
+	}
+	if ValidateBlock(state, nil, block, params) == nil {
+		t.Error("valid block rejected")
+	}
+	block.Events = append(block.Events, newEvent(1, 9))
+	if ValidateBlock(state, nil, block, params) != nil {
+		t.Error("block with too many events accepted")
+	}
+	block.Events = Events{oversized}
+	if ValidateBlock(state, nil, block, params) != nil {
+		t.Error("block with oversized event accepted")
+	}
+	params.MaxBlockEvents = 1 << 16
+	if params.Check() == nil {
+		t.Error("event count beyond uint16 accepted")
+	}
+}
+
+func TestZeroParamsAreDefaults(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	pool := NewInstructionPool()
+	event := newEvent(1, 0)
+	pool.Queue(event, event.Hash())
+	state := &bytesState{}
+	block := (<-BlockBuilder(crypto.ZeroHash, 0, 1, token, time.Now(), pool, state.Overlay(nil, 1), ConsensusParams{}, SystemTime))()
+	block.Sign(key)
+	if len(block.Events) != 1 {
+		t.Fatal("builder with zero params dropped the event")
+	}
+	if ValidateBlock(state, nil, block, ConsensusParams{}) == nil {
+		t.Error("block rejected by zero params")
+	}
+	if (ConsensusParams{}).Check() != nil {
+		t.Error("zero params not valid")
+	}
+}
+
+// rejectingOverlay rejects the events with payload 1.
+type rejectingOverlay struct {
+	*bytesOverlay
+}
+
+func (o rejectingOverlay) Apply(event Event) bool {
+	return event[len(event)-1] != 1 && o.bytesOverlay.Apply(event)
+}
+
+func TestBuilderLeavesAndDrops(t *testing.T) {
+	token, _ := crypto.RandomAsymetricKey()
+	pool := NewInstructionPool()
+	events := Events{newEvent(1, 0), newEvent(1, 1), newEvent(1, 2), append(newEvent(1, 3), make([]byte, 50)...), newEvent(1, 4)}
+	for _, event := range events {
+		pool.Queue(event, event.Hash())
+	}
+	empty := &Block{Clock: 1, Publisher: token, Events: make(Events, 0)}
+	params := ConsensusParams{MaxBlockBytes: empty.Size() + 2*(2+10) + 20, MaxBlockEvents: 10, MaxEventSize: 100}
+	overlay := rejectingOverlay{&bytesOverlay{clock: 1}}
+	block := (<-BlockBuilder(crypto.ZeroHash, 0, 1, token, time.Now(), pool, overlay, params, SystemTime))()
+	if len(block.Events) != 2 || string(block.Events[0]) != string(events[0]) || string(block.Events[1]) != string(events[2]) {
+		t.Fatalf("wrong events in the block: %v", len(block.Events))
+	}
+	// the event that does not fit stays first and the rejected one is dropped
+	if next, _ := pool.Peek(); pool.Len() != 2 || string(next) != string(events[3]) {
+		t.Fatal("events left in the pool out of place")
+	}
+	if stats := pool.Stats(); stats.Queued != 5 || stats.Unqueued != 3 {
+		t.Fatalf("events queued again: %+v", stats)
+	}
+}
@@ -0,0 +1,104 @@
+package swell
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// parsers are the entry points of bytes received from peers. None of them
+// must panic, whatever the input.
+var parsers = map[string]func([]byte){
+	"block":        func(data []byte) { ParseBlock(data) },
+	"header":       func(data []byte) { ParseBlockHeader(data) },
+	"signed block": func(data []byte) { ParseSignedBlock(data) },
+	"blocks":       func(data []byte) { ParseSignedBlocks(data) },
+	"vote":         func(data []byte) { ParseVote(data) },
+	"certificate":  func(data []byte) { ParseQuorumCertificate(data) },
+	"proposal":     func(data []byte) { ParseProposal(data) },
+	"evidence":     func(data []byte) { ParseEvidence(data) },
+	"checksum":     func(data []byte) { ParseStateChecksum(data) },
+	"denunciation": func(data []byte) { ParseChecksumDenunciation(data) },
+	"manifest":     func(data []byte) { ParseSnapshotManifest(data) },
+	"event proof":  func(data []byte) { ParseEventProof(data) },
+	"signed event": func(data []byte) { ParseSignedEvent(Event(data)) },
+	"registry":     func(data []byte) { NewValidatorRegistry(nil, 0).Restore(data) },
+}
+
+// validMessages returns a well formed encoding of every message type.
+func validMessages() [][]byte {
+	_, key := crypto.RandomAsymetricKey()
+	block := &Block{Clock: 2, Publisher: key.PublicKey(), PublishedAt: time.Unix(1, 0), Events: Events{Event{0, 1}, Event{0, 2}, Event{0, 3}}}
+	block.Sign(key)
+	other := &Block{Clock: 2, Publisher: key.PublicKey(), PublishedAt: time.Unix(2, 0)}
+	other.Sign(key)
+	hash := block.Hash()
+	signature := Signature{Hash: hash, Token: key.PublicKey(), Signature: key.Sign(hash[:])}
+	signed := &SignedBlock{Block: block, Signatures: []Signature{signature}}
+	certificate := &QuorumCertificate{Clock: 2, Hash: hash, Signatures: []Signature{signature}}
+	checksum := NewStateChecksum(2, hash, key)
+	registry := NewValidatorRegistry([]Validator{{Token: key.PublicKey(), Stake: 1}}, 0)
+	registry.Deposit(1, crypto.ZeroToken, 2)
+	return [][]byte{
+		block.Serialize(),
+		block.SerializeHeader(),
+		signed.Serialize(),
+		SignedBlocks{signed, signed}.Serialize(),
+		NewVote(Precommit, 2, 1, hash, key).Serialize(),
+		certificate.Serialize(),
+		NewProposal(1, -1, block, certificate, key).Serialize(),
+		NewDoubleProposal(block, other).Serialize(),
+		checksum.Serialize(),
+		(&ChecksumDenunciation{Clock: 2, Majority: []*StateChecksum{checksum}}).Serialize(),
+		(&SnapshotManifest{Clock: 2, Checkpoint: signed, Registry: registry.Serialize(), Chunks: []crypto.Hash{hash}}).Serialize(),
+		block.EventProof(1).Serialize(),
+		NewSignedEvent(2, []byte{1, 2, 3}, key),
+		registry.Serialize(),
+	}
+}
+
+func parseAll(t *testing.T, data []byte) {
+	for name, parse := range parsers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("%v parser panicked on %x: %v", name, data, r)
+				}
+			}()
+			parse(data)
+		}()
+	}
+}
+
+func TestParseGarbage(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for _, message := range validMessages() {
+		parseAll(t, message)
+		for size := 0; size < len(message); size++ {
+			parseAll(t, message[:size])
+		}
+		for n := 0; n < 200; n++ {
+			mutated := append([]byte{}, message...)
+			for flips := random.Intn(4) + 1; flips > 0; flips-- {
+				mutated[random.Intn(len(mutated))] = byte(random.Intn(256))
+			}
+			parseAll(t, mutated)
+		}
+	}
+	for n := 0; n < 1000; n++ {
+		garbage := make([]byte, random.Intn(512))
+		random.Read(garbage)
+		parseAll(t, garbage)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, message := range validMessages() {
+		f.Add(message)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseAll(t, data)
+	})
+}
@@ -0,0 +1,322 @@
+// Package simulation runs several nodes of a consensus engine in a single
+// process over an in-memory network driven by a virtual clock.
+//
+// Only one node runs at a time. The simulation hands a node a message or
+// fires one of its timers, waits until the engine has processed it and
+// collects what the engine published before moving on, so that a run is
+// fully determined by its seed and script. Engines must take the time only
+// from the chain TimeSource and answer PeerRequest, which the simulation
+// uses to know a node is idle.
+package simulation
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"math/rand"
+	"time"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// Genesis is the genesis time of every simulation.
+var Genesis = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type Config struct {
+	Seed     int64
+	Nodes    int
+	Stake    uint64 // stake of each node
+	Engine   swell.ConsensusEngine
+	NewState func(node int) swell.State
+	MinDelay time.Duration // delay of a message between two nodes
+	MaxDelay time.Duration
+	DropRate float64       // probability that a message is lost
+	Slot     time.Duration // slot duration of the calendar, the default if zero
+	Epoch    uint64        // slots of an epoch of the calendar, the default if zero
+}
+
+// Record is an entry of the trace of a run.
+type Record struct {
+	At   time.Duration // since genesis
+	Node int
+	Kind string
+	Hash crypto.Hash
+}
+
+type Node struct {
+	Index     int
+	Key       crypto.PrivateKey
+	Chain     *swell.BlockChain
+	Comm      *swell.Communication
+	Finalized []*swell.SignedBlock
+	Diverged  []*swell.ChecksumDenunciation
+	Changes   []*swell.SetChange
+	crashed   bool
+}
+
+type action struct {
+	at   time.Time
+	seq  uint64
+	node int // -1 for script actions
+	run  func()
+}
+
+type actions []*action
+
+type heldMessage struct {
+	delay   time.Duration
+	node    int
+	deliver func()
+}
+
+func (a actions) Len() int { return len(a) }
+
+func (a actions) Less(i, j int) bool {
+	if a[i].at.Equal(a[j].at) {
+		return a[i].seq < a[j].seq
+	}
+	return a[i].at.Before(a[j].at)
+}
+
+func (a actions) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+
+func (a *actions) Push(x interface{}) { *a = append(*a, x.(*action)) }
+
+func (a *actions) Pop() interface{} {
+	old := *a
+	last := old[len(old)-1]
+	*a = old[:len(old)-1]
+	return last
+}
+
+// Simulation is a run of Config.Nodes nodes. Every node is a validator of
+// the same genesis.
+type Simulation struct {
+	Nodes     []*Node
+	config    Config
+	rand      *rand.Rand
+	now       time.Time
+	seq       uint64
+	queue     actions
+	partition []int         // group of each node, all in the same group if nil
+	held      []heldMessage // messages across the partition
+	trace     []Record
+}
+
+// nodeTime is the TimeSource of a node: its timers fire only while the
+// simulation runs and the node is up.
+type nodeTime struct {
+	simulation *Simulation
+	node       int
+}
+
+func (t *nodeTime) Now() time.Time { return t.simulation.now }
+
+func (t *nodeTime) AfterFunc(d time.Duration, f func()) {
+	t.simulation.schedule(d, t.node, f)
+}
+
+// New creates the nodes, with keys derived from the seed, and starts their
+// engines at genesis.
+func New(config Config) *Simulation {
+	s := &Simulation{config: config, rand: rand.New(rand.NewSource(config.Seed)), now: Genesis}
+	seed := make([]byte, 8)
+	binary.LittleEndian.PutUint64(seed, uint64(config.Seed))
+	genesis := crypto.Hasher(seed)
+	validators := make([]swell.Validator, config.Nodes)
+	s.Nodes = make([]*Node, config.Nodes)
+	for n := range s.Nodes {
+		var keySeed [32]byte
+		binary.LittleEndian.PutUint64(keySeed[:], uint64(config.Seed))
+		binary.LittleEndian.PutUint64(keySeed[8:], uint64(n))
+		s.Nodes[n] = &Node{Index: n, Key: crypto.PrivateKeyFromSeed(keySeed)}
+		validators[n] = swell.Validator{Token: s.Nodes[n].Key.PublicKey(), Stake: config.Stake}
+	}
+	for n, node := range s.Nodes {
+		node.Chain = &swell.BlockChain{
+			GenesisHash:  genesis,
+			GenesisTime:  Genesis,
+			SlotDuration: config.Slot,
+			EpochSlots:   config.Epoch,
+			TotalStake:   config.Stake * uint64(config.Nodes),
+			Validators:   validators,
+			CurrentState: config.NewState(n),
+			Time:         &nodeTime{simulation: s, node: n},
+		}
+		node.Comm = swell.LauchNewGenesisConsensus(config.Engine, node.Chain, node.Key)
+		s.settle(node)
+	}
+	return s
+}
+
+// Now returns the virtual time.
+func (s *Simulation) Now() time.Time {
+	return s.now
+}
+
+// Trace returns what happened in the run so far. Two runs with the same
+// configuration and script have the same trace.
+func (s *Simulation) Trace() []Record {
+	return s.trace
+}
+
+func (s *Simulation) record(node int, kind string, hash crypto.Hash) {
+	s.trace = append(s.trace, Record{At: s.now.Sub(Genesis), Node: node, Kind: kind, Hash: hash})
+}
+
+func (s *Simulation) schedule(d time.Duration, node int, run func()) {
+	if d < 0 {
+		d = 0
+	}
+	s.seq += 1
+	heap.Push(&s.queue, &action{at: s.now.Add(d), seq: s.seq, node: node, run: run})
+}
+
+// At runs action, a step of the test script, at offset since genesis.
+func (s *Simulation) At(offset time.Duration, action func()) {
+	s.schedule(Genesis.Add(offset).Sub(s.now), -1, action)
+}
+
+// Run advances the virtual clock by d, running every action due.
+func (s *Simulation) Run(d time.Duration) {
+	end := s.now.Add(d)
+	for len(s.queue) > 0 && !s.queue[0].at.After(end) {
+		next := heap.Pop(&s.queue).(*action)
+		s.now = next.at
+		if next.node < 0 {
+			next.run()
+			continue
+		}
+		if node := s.Nodes[next.node]; !node.crashed {
+			next.run()
+			s.settle(node)
+		}
+	}
+	s.now = end
+}
+
+// settle waits until node has processed what it was handed and sends what it
+// published to the other nodes. Channels are drained one after the other so
+// that the order of the messages does not depend on the scheduler.
+func (s *Simulation) settle(node *Node) {
+	response := make(chan bool)
+	node.Comm.PeerRequest <- &swell.PeerRequest{Response: response}
+	<-response
+	comm := node.Comm
+	for len(comm.NewBlock) > 0 {
+		block := <-comm.NewBlock
+		s.broadcast(node, "block", block.Hash(), func(to *Node) { to.Comm.IncomingBlock <- block })
+	}
+	for len(comm.Proposal) > 0 {
+		proposal := <-comm.Proposal
+		s.broadcast(node, "proposal", proposal.Block.Hash(), func(to *Node) { to.Comm.IncomingProposal <- proposal })
+	}
+	for len(comm.BlockSignature) > 0 {
+		signature := <-comm.BlockSignature
+		s.broadcast(node, "signature", signature.Hash, func(to *Node) { to.Comm.IncomingSignature <- signature })
+	}
+	for len(comm.Vote) > 0 {
+		vote := <-comm.Vote
+		s.broadcast(node, "vote", vote.Hash, func(to *Node) { to.Comm.IncomingVote <- vote })
+	}
+	for len(comm.Evidence) > 0 {
+		evidence := <-comm.Evidence
+		s.broadcast(node, "evidence", evidence.Hash(), func(to *Node) { to.Comm.IncomingEvidence <- evidence })
+	}
+	for len(comm.Checksum) > 0 {
+		checksum := <-comm.Checksum
+		s.broadcast(node, "checksum", checksum.Hash, func(to *Node) { to.Comm.IncomingChecksum <- checksum })
+	}
+	for len(comm.Checkpoint) > 0 {
+		signed := <-comm.Checkpoint
+		node.Finalized = append(node.Finalized, signed)
+		s.record(node.Index, "finalized", signed.Block.Hash())
+	}
+	for len(comm.SetChange) > 0 {
+		change := <-comm.SetChange
+		node.Changes = append(node.Changes, change)
+		s.record(node.Index, "set change", change.Signature.Hash)
+	}
+	for len(comm.ChecksumDiverged) > 0 {
+		denunciation := <-comm.ChecksumDiverged
+		node.Diverged = append(node.Diverged, denunciation)
+		s.record(node.Index, "diverged", denunciation.Own)
+	}
+}
+
+// broadcast delivers a message of from to every other node after a random
+// delay unless it is lost. Messages across a partition are held until it
+// heals.
+func (s *Simulation) broadcast(from *Node, kind string, hash crypto.Hash, deliver func(to *Node)) {
+	s.record(from.Index, kind, hash)
+	for _, to := range s.Nodes {
+		if to == from {
+			continue
+		}
+		delay := s.config.MinDelay
+		if s.config.MaxDelay > s.config.MinDelay {
+			delay += time.Duration(s.rand.Int63n(int64(s.config.MaxDelay - s.config.MinDelay)))
+		}
+		if s.rand.Float64() < s.config.DropRate {
+			continue
+		}
+		to := to
+		if !s.connected(from.Index, to.Index) {
+			s.held = append(s.held, heldMessage{delay: delay, node: to.Index, deliver: func() { deliver(to) }})
+			continue
+		}
+		s.schedule(delay, to.Index, func() { deliver(to) })
+	}
+}
+
+// Submit hands event to node now.
+func (s *Simulation) Submit(node int, event swell.Event) {
+	to := s.Nodes[node]
+	s.schedule(0, node, func() { to.Comm.Events <- event })
+}
+
+// SetDelay changes the range of message delays.
+func (s *Simulation) SetDelay(min, max time.Duration) {
+	s.config.MinDelay, s.config.MaxDelay = min, max
+}
+
+// SetDropRate changes the probability that a message is lost.
+func (s *Simulation) SetDropRate(rate float64) {
+	s.config.DropRate = rate
+}
+
+// Partition splits the nodes into groups that cannot reach each other until
+// Heal. Nodes not in any group are isolated. Messages already sent are still
+// delivered.
+func (s *Simulation) Partition(groups ...[]int) {
+	s.partition = make([]int, len(s.Nodes))
+	for n := range s.partition {
+		s.partition[n] = -1 - n
+	}
+	for group, nodes := range groups {
+		for _, node := range nodes {
+			s.partition[node] = group
+		}
+	}
+}
+
+// Heal removes the partition and delivers the messages held by it, each
+// after its delay counted from now.
+func (s *Simulation) Heal() {
+	s.partition = nil
+	for _, held := range s.held {
+		s.schedule(held.delay, held.node, held.deliver)
+	}
+	s.held = nil
+}
+
+func (s *Simulation) connected(from, to int) bool {
+	return s.partition == nil || s.partition[from] == s.partition[to]
+}
+
+// Crash stops node for the rest of the run. It no longer receives messages
+// and its timers do not fire.
+func (s *Simulation) Crash(node int) {
+	s.Nodes[node].crashed = true
+	s.record(node, "crashed", crypto.ZeroValueHash)
+}
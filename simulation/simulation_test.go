@@ -0,0 +1,145 @@
+package simulation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/consensus/hotstuff"
+	slots "github.com/lienkolabs/swell/consensus/swell"
+	"github.com/lienkolabs/swell/consensus/tendermint"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// checkAgreement checks that no two nodes finalized different blocks for the
+// same clock.
+func checkAgreement(t *testing.T, s *Simulation) {
+	blocks := make(map[uint64]crypto.Hash)
+	for _, node := range s.Nodes {
+		for _, signed := range node.Finalized {
+			hash := signed.Block.Hash()
+			if other, ok := blocks[signed.Block.Clock]; ok && other != hash {
+				t.Fatalf("nodes finalized different blocks for clock %v", signed.Block.Clock)
+			}
+			blocks[signed.Block.Clock] = hash
+		}
+	}
+}
+
+// script runs a simulation with lossy links, a partition and a crashed node.
+func script(engine swell.ConsensusEngine, seed int64) *Simulation {
+	s := New(Config{
+		Seed:     seed,
+		Nodes:    5,
+		Stake:    10,
+		Engine:   engine,
+		NewState: NewState,
+		MinDelay: 5 * time.Millisecond,
+		MaxDelay: 50 * time.Millisecond,
+		DropRate: 0.02,
+	})
+	for n := 0; n < 20; n++ {
+		event := NewEvent(uint64(n + 1))
+		s.At(time.Duration(n)*200*time.Millisecond, func() { s.Submit(n%5, event) })
+	}
+	s.At(2*time.Second, func() { s.Partition([]int{0, 1, 2}, []int{3, 4}) })
+	s.At(5*time.Second, func() { s.Heal() })
+	s.At(6*time.Second, func() { s.Crash(4) })
+	s.Run(15 * time.Second)
+	return s
+}
+
+func TestReplayFromSeed(t *testing.T) {
+	for _, engine := range []swell.ConsensusEngine{slots.NewEngine, tendermint.NewEngine, hotstuff.NewEngine} {
+		first, second := script(engine, 7), script(engine, 7)
+		if len(first.Trace()) == 0 || !reflect.DeepEqual(first.Trace(), second.Trace()) {
+			t.Fatal("runs with the same seed diverged")
+		}
+		for n, node := range first.Nodes {
+			if !reflect.DeepEqual(node.Finalized, second.Nodes[n].Finalized) {
+				t.Fatal("runs with the same seed finalized different signed blocks")
+			}
+		}
+		if reflect.DeepEqual(first.Trace(), script(engine, 8).Trace()) {
+			t.Error("runs with different seeds are identical")
+		}
+		checkAgreement(t, first)
+		for _, node := range first.Nodes[:4] {
+			if len(node.Finalized) == 0 || node.Finalized[len(node.Finalized)-1].Block.Clock < 3 {
+				t.Fatal("nodes did not make progress")
+			}
+		}
+	}
+}
+
+func TestPartitionStallsAndHeals(t *testing.T) {
+	s := New(Config{
+		Seed:     1,
+		Nodes:    4,
+		Stake:    10,
+		Engine:   tendermint.NewEngine,
+		NewState: NewState,
+		MinDelay: 10 * time.Millisecond,
+		MaxDelay: 20 * time.Millisecond,
+	})
+	s.Partition([]int{0, 1}, []int{2, 3})
+	s.Run(10 * time.Second)
+	for _, node := range s.Nodes {
+		if len(node.Finalized) != 0 {
+			t.Fatal("block finalized without quorum")
+		}
+	}
+	s.Heal()
+	s.Submit(0, NewEvent(1))
+	s.Run(30 * time.Second)
+	checkAgreement(t, s)
+	for _, node := range s.Nodes {
+		if len(node.Finalized) == 0 {
+			t.Fatal("no progress after the partition healed")
+		}
+	}
+}
+
+func TestEpochSeedsWithChecksums(t *testing.T) {
+	s := New(Config{
+		Seed:     3,
+		Nodes:    4,
+		Stake:    10,
+		Engine:   slots.NewEngine,
+		NewState: NewChecksumState,
+		MinDelay: 5 * time.Millisecond,
+		MaxDelay: 50 * time.Millisecond,
+		Epoch:    5,
+	})
+	s.Run(40 * time.Second)
+	checkAgreement(t, s)
+	checksums := 0
+	for _, record := range s.Trace() {
+		if record.Kind == "checksum" {
+			checksums += 1
+		}
+	}
+	if checksums == 0 {
+		t.Fatal("no checksum exchanged")
+	}
+	first := s.Nodes[0].Chain
+	calendar := first.Calendar()
+	for _, node := range s.Nodes {
+		if len(node.Diverged) > 0 {
+			t.Fatal("node diverged from the agreed checksum")
+		}
+		if len(node.Finalized) == 0 || calendar.Epoch(node.Finalized[len(node.Finalized)-1].Block.Clock) < 6 {
+			t.Fatal("nodes did not make progress across epochs")
+		}
+		// leaders follow the seeds of the finalized chain
+		chain := &swell.BlockChain{GenesisHash: first.GenesisHash, EpochSlots: first.EpochSlots, RecentBlocks: node.Finalized}
+		schedule := slots.NewSchedule(first.GenesisHash, calendar, first.Validators)
+		schedule.SeedFrom(chain)
+		for _, signed := range node.Finalized {
+			if signed.Block.Publisher != schedule.Leader(signed.Block.Clock) {
+				t.Fatalf("block of clock %v not published by the leader of the finalized seed", signed.Block.Clock)
+			}
+		}
+	}
+}
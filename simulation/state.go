@@ -0,0 +1,74 @@
+package simulation
+
+import (
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/util"
+)
+
+// State is a swell.State for tests of consensus engines. It accepts every
+// event with a positive clock (see NewEvent) and keeps only the clock of the
+// last committed overlay.
+type State struct {
+	clock     uint64
+	checksums bool
+}
+
+// NewState returns an empty State for any node, as Config.NewState.
+func NewState(node int) swell.State {
+	return &State{}
+}
+
+// NewChecksumState returns an empty State for any node whose checksum is the
+// hash of its clock, as Config.NewState.
+func NewChecksumState(node int) swell.State {
+	return &State{checksums: true}
+}
+
+// NewEvent returns an event accepted by State, distinct for every n > 0.
+func NewEvent(n uint64) swell.Event {
+	event := swell.Event{swell.Version}
+	util.PutUint64(n, (*[]byte)(&event))
+	return event
+}
+
+type overlay struct {
+	clock uint64
+}
+
+func (o *overlay) Clock() uint64 { return o.clock }
+
+func (o *overlay) Apply(event swell.Event) bool { return event.Clock() > 0 }
+
+func (s *State) LastCheckPoint() swell.Checkpoint { return nil }
+
+func (s *State) ChecksumJob() chan crypto.Hash {
+	if !s.checksums {
+		return nil
+	}
+	job := make(chan crypto.Hash, 1)
+	bytes := make([]byte, 0)
+	util.PutUint64(s.clock, &bytes)
+	job <- crypto.Hasher(bytes)
+	return job
+}
+
+func (s *State) Validate(event swell.Event) bool { return event.Clock() > 0 }
+
+func (s *State) Overlay(parent swell.Overlay, clock uint64) swell.Overlay {
+	return &overlay{clock: clock}
+}
+
+func (s *State) Commit(overlay swell.Overlay) error {
+	s.clock = overlay.Clock()
+	return nil
+}
+
+func (s *State) Rollback(overlay swell.Overlay) {}
+
+func (s *State) Snapshot() *swell.Snapshot { return &swell.Snapshot{Clock: s.clock} }
+
+func (s *State) Restore(snapshot *swell.Snapshot) error {
+	s.clock = snapshot.Clock
+	return nil
+}
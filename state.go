@@ -2,11 +2,67 @@ package swell
 
 import "github.com/lienkolabs/swell/crypto"
 
+// State is the application state machine driven by the consensus engine.
+//
+// Blocks are applied speculatively into pending overlays, one per candidate
+// block, so that competing candidates for the same clock can be validated
+// independently. Once a candidate is finalized its overlay is committed and
+// the overlays of the other candidates are rolled back.
 type State interface {
 	LastCheckPoint() Checkpoint
+	// ChecksumJob starts computing the checksum of the committed state at
+	// its last checkpoint and returns the channel on which it is delivered,
+	// or nil if the state does not compute checksums.
 	ChecksumJob() chan crypto.Hash
+	// Validate checks event against the committed state. It is used to admit
+	// events into the pool.
+	Validate(event Event) bool
+	// Overlay returns a new empty overlay for the block at clock on top of
+	// parent, or on top of the committed state if parent is nil.
+	Overlay(parent Overlay, clock uint64) Overlay
+	// Commit incorporates overlay into the committed state. The committed
+	// state checkpoint becomes the overlay clock.
+	Commit(overlay Overlay) error
+	// Rollback discards overlay and every overlay built on top of it.
+	Rollback(overlay Overlay)
+	// Snapshot returns the committed state at its last checkpoint. Its
+	// SnapshotChecksum must be the checksum the state reports for that
+	// checkpoint, so that syncing nodes can verify it.
+	Snapshot() *Snapshot
+	// Restore replaces the committed state by snapshot.
+	Restore(snapshot *Snapshot) error
+}
+
+// Overlay accumulates the mutations of a block not yet finalized.
+type Overlay interface {
+	Clock() uint64
+	// Apply validates event against the overlay and, if valid, incorporates
+	// its mutations.
+	Apply(event Event) bool
 }
 
 type Checkpoint interface {
 	Clock() uint64
 }
+
+type Snapshot struct {
+	Clock uint64
+	Data  []byte
+}
+
+// ValidateBlock checks block against the limits of params and applies every
+// event into a new overlay on top of parent. It returns nil, after rolling the
+// overlay back, if the block exceeds the limits or any event is rejected.
+func ValidateBlock(state State, parent Overlay, block *Block, params ConsensusParams) Overlay {
+	if !params.CheckLimits(block) {
+		return nil
+	}
+	overlay := state.Overlay(parent, block.Clock)
+	for _, event := range block.Events {
+		if !overlay.Apply(event) {
+			state.Rollback(overlay)
+			return nil
+		}
+	}
+	return overlay
+}
@@ -0,0 +1,351 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+// Store is an append-only file backed store of signed blocks.
+//
+// Blocks are appended to numbered segment files. Each record is framed as a
+// little-endian uint32 payload length, a crc32 (IEEE) checksum of the payload
+// and the payload itself, the bytes of SignedBlock.Serialize. Once a segment
+// grows beyond the configured size a new one is started.
+//
+// Indexes by clock and by hash are kept in memory and rebuilt by scanning the
+// segments when the store is opened. A record half written on the last
+// segment by a crash is detected by its length or checksum and the segment is
+// truncated back to the last complete record.
+
+const (
+	DefaultSegmentSize = 1 << 26
+	headerSize         = 8
+	segmentExtension   = ".seg"
+)
+
+var (
+	ErrOutOfOrder = errors.New("block clock must be greater than last stored clock")
+	ErrNotFound   = errors.New("block not found")
+	ErrCorrupted  = errors.New("corrupted block store segment")
+	ErrClosed     = errors.New("block store is closed")
+)
+
+type location struct {
+	segment int
+	offset  int64
+	size    uint32
+}
+
+type Store struct {
+	mu          sync.RWMutex
+	path        string
+	segmentSize int64
+	segments    []*os.File
+	size        int64 // size of the last segment
+	clocks      []uint64
+	locations   []location
+	hashes      map[crypto.Hash]int
+	closed      bool
+}
+
+// Open opens or creates a block store in the directory path. segmentSize is
+// the size after which a new segment file is started; if zero
+// DefaultSegmentSize is used.
+func Open(path string, segmentSize int64) (*Store, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(path, "*"+segmentExtension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	store := &Store{
+		path:        path,
+		segmentSize: segmentSize,
+		segments:    make([]*os.File, 0),
+		clocks:      make([]uint64, 0),
+		locations:   make([]location, 0),
+		hashes:      make(map[crypto.Hash]int),
+	}
+	for n, name := range names {
+		if name != store.segmentName(n) {
+			store.Close()
+			return nil, fmt.Errorf("unexpected segment file %v", name)
+		}
+		file, err := os.OpenFile(name, os.O_RDWR, 0644)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		store.segments = append(store.segments, file)
+		if err := store.recover(n, n == len(names)-1); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+	if len(store.segments) == 0 {
+		if err := store.newSegment(); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+func (s *Store) segmentName(n int) string {
+	return filepath.Join(s.path, fmt.Sprintf("%08d%v", n, segmentExtension))
+}
+
+func (s *Store) newSegment() error {
+	file, err := os.OpenFile(s.segmentName(len(s.segments)), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, file)
+	s.size = 0
+	return nil
+}
+
+// recover scans segment n and indexes every complete record. If last is true
+// a trailing incomplete or corrupted record is truncated away, otherwise it is
+// reported as ErrCorrupted. A complete record out of clock order is never
+// truncated: it is reported as ErrOutOfOrder.
+func (s *Store) recover(n int, last bool) error {
+	file := s.segments[n]
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	offset := int64(0)
+	header := make([]byte, headerSize)
+	for offset < size {
+		payload, err := readRecord(file, offset, size, header)
+		var signed *swell.SignedBlock
+		if err == nil {
+			if signed = swell.ParseSignedBlock(payload); signed == nil {
+				err = ErrCorrupted
+			}
+		}
+		if err != nil {
+			if !last {
+				return ErrCorrupted
+			}
+			if err := file.Truncate(offset); err != nil {
+				return err
+			}
+			if err := file.Sync(); err != nil {
+				return err
+			}
+			break
+		}
+		if err := s.index(signed, location{segment: n, offset: offset, size: uint32(len(payload))}); err != nil {
+			return err
+		}
+		offset += headerSize + int64(len(payload))
+	}
+	s.size = offset
+	return nil
+}
+
+func readRecord(file *os.File, offset, limit int64, header []byte) ([]byte, error) {
+	if offset+headerSize > limit {
+		return nil, ErrCorrupted
+	}
+	if _, err := file.ReadAt(header, offset); err != nil {
+		return nil, ErrCorrupted
+	}
+	length := binary.LittleEndian.Uint32(header[0:4])
+	checksum := binary.LittleEndian.Uint32(header[4:8])
+	if offset+headerSize+int64(length) > limit {
+		return nil, ErrCorrupted
+	}
+	payload := make([]byte, length)
+	if _, err := file.ReadAt(payload, offset+headerSize); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, ErrCorrupted
+	}
+	return payload, nil
+}
+
+func (s *Store) index(signed *swell.SignedBlock, loc location) error {
+	clock := signed.Block.Clock
+	if len(s.clocks) > 0 && clock <= s.clocks[len(s.clocks)-1] {
+		return ErrOutOfOrder
+	}
+	s.hashes[signed.Block.Hash()] = len(s.clocks)
+	s.clocks = append(s.clocks, clock)
+	s.locations = append(s.locations, loc)
+	return nil
+}
+
+// Append writes a signed block to the end of the store. Blocks must be
+// appended in strictly increasing clock order. The segment is synced to disk
+// before Append returns.
+func (s *Store) Append(signed *swell.SignedBlock) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if len(s.clocks) > 0 && signed.Block.Clock <= s.clocks[len(s.clocks)-1] {
+		return ErrOutOfOrder
+	}
+	payload := signed.Serialize()
+	if s.size > 0 && s.size+headerSize+int64(len(payload)) > s.segmentSize {
+		if err := s.newSegment(); err != nil {
+			return err
+		}
+	}
+	record := make([]byte, headerSize, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	record = append(record, payload...)
+	file := s.segments[len(s.segments)-1]
+	if _, err := file.WriteAt(record, s.size); err != nil {
+		// leave no partial record behind for the next append
+		file.Truncate(s.size)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	loc := location{segment: len(s.segments) - 1, offset: s.size, size: uint32(len(payload))}
+	s.size += int64(len(record))
+	return s.index(signed, loc)
+}
+
+func (s *Store) read(n int) (*swell.SignedBlock, error) {
+	loc := s.locations[n]
+	limit := loc.offset + headerSize + int64(loc.size)
+	payload, err := readRecord(s.segments[loc.segment], loc.offset, limit, make([]byte, headerSize))
+	if err != nil {
+		return nil, err
+	}
+	signed := swell.ParseSignedBlock(payload)
+	if signed == nil {
+		return nil, ErrCorrupted
+	}
+	return signed, nil
+}
+
+// Get returns the block stored for clock.
+func (s *Store) Get(clock uint64) (*swell.SignedBlock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	n := sort.Search(len(s.clocks), func(i int) bool { return s.clocks[i] >= clock })
+	if n == len(s.clocks) || s.clocks[n] != clock {
+		return nil, ErrNotFound
+	}
+	return s.read(n)
+}
+
+// GetByHash returns the block identified by hash.
+func (s *Store) GetByHash(hash crypto.Hash) (*swell.SignedBlock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	n, ok := s.hashes[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.read(n)
+}
+
+// Range returns every stored block with clock in the interval [from, to] in
+// clock order.
+func (s *Store) Range(from, to uint64) (swell.SignedBlocks, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	blocks := make(swell.SignedBlocks, 0)
+	start := sort.Search(len(s.clocks), func(i int) bool { return s.clocks[i] >= from })
+	for n := start; n < len(s.clocks) && s.clocks[n] <= to; n++ {
+		signed, err := s.read(n)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, signed)
+	}
+	return blocks, nil
+}
+
+// Tail returns the last count blocks of the store in clock order, none if
+// count is not positive.
+func (s *Store) Tail(count int) (swell.SignedBlocks, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	if count < 0 {
+		count = 0
+	}
+	start := len(s.clocks) - count
+	if start < 0 {
+		start = 0
+	}
+	blocks := make(swell.SignedBlocks, 0, len(s.clocks)-start)
+	for n := start; n < len(s.clocks); n++ {
+		signed, err := s.read(n)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, signed)
+	}
+	return blocks, nil
+}
+
+// LastClock returns the clock of the most recent block, and false if the
+// store is empty.
+func (s *Store) LastClock() (uint64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.clocks) == 0 {
+		return 0, false
+	}
+	return s.clocks[len(s.clocks)-1], true
+}
+
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.clocks)
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	var err error
+	for _, file := range s.segments {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
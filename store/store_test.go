@@ -0,0 +1,151 @@
+package store
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell"
+	"github.com/lienkolabs/swell/crypto"
+)
+
+func signedBlock(clock uint64, key crypto.PrivateKey) *swell.SignedBlock {
+	block := &swell.Block{
+		Clock:       clock,
+		Publisher:   key.PublicKey(),
+		PublishedAt: time.Unix(int64(clock), 0),
+		Events:      swell.Events{swell.Event{0, byte(clock), 1, 2, 3}},
+	}
+	block.Sign(key)
+	return &swell.SignedBlock{Block: block, Signatures: []swell.Signature{}}
+}
+
+func TestAppendAndRead(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	dir := t.TempDir()
+	store, err := Open(dir, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for clock := uint64(1); clock <= 20; clock++ {
+		if err := store.Append(signedBlock(clock, key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Append(signedBlock(20, key)); err != ErrOutOfOrder {
+		t.Errorf("expected out of order error, got %v", err)
+	}
+	if len(store.segments) < 2 {
+		t.Errorf("expected several segments, got %v", len(store.segments))
+	}
+	blocks, err := store.Range(5, 9)
+	if err != nil || len(blocks) != 5 || blocks[0].Block.Clock != 5 || blocks[4].Block.Clock != 9 {
+		t.Fatalf("wrong range read: %v", err)
+	}
+	tail, err := store.Tail(3)
+	if err != nil || len(tail) != 3 || tail[2].Block.Clock != 20 {
+		t.Fatalf("wrong tail read: %v", err)
+	}
+	if none, err := store.Tail(-1); err != nil || len(none) != 0 {
+		t.Fatalf("wrong tail of negative count: %v", err)
+	}
+	hash := tail[0].Block.Hash()
+	byHash, err := store.GetByHash(hash)
+	if err != nil || byHash.Block.Clock != 18 {
+		t.Fatalf("wrong read by hash: %v", err)
+	}
+	store.Close()
+
+	reopened, err := Open(dir, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if reopened.Len() != 20 {
+		t.Fatalf("expected 20 blocks after reopening, got %v", reopened.Len())
+	}
+	if block, err := reopened.Get(7); err != nil || block.Block.Clock != 7 {
+		t.Errorf("wrong read after reopening: %v", err)
+	}
+}
+
+func TestRecoverHalfWrittenSegment(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	dir := t.TempDir()
+	store, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for clock := uint64(1); clock <= 3; clock++ {
+		if err := store.Append(signedBlock(clock, key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := store.size
+	store.Close()
+
+	// simulate a crash in the middle of writing the fourth record
+	name := filepath.Join(dir, "00000000"+segmentExtension)
+	record := signedBlock(4, key).Serialize()
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{byte(len(record)), byte(len(record) >> 8), 0, 0, 1, 2, 3, 4})
+	file.Write(record[:len(record)/2])
+	file.Close()
+
+	recovered, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Close()
+	if recovered.Len() != 3 || recovered.size != size {
+		t.Fatalf("half written record not discarded: %v blocks", recovered.Len())
+	}
+	if err := recovered.Append(signedBlock(4, key)); err != nil {
+		t.Fatal(err)
+	}
+	if block, err := recovered.Get(4); err != nil || block.Block.Clock != 4 {
+		t.Errorf("could not read block appended after recovery: %v", err)
+	}
+}
+
+func TestRecoverOutOfOrder(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	dir := t.TempDir()
+	store, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for clock := uint64(2); clock <= 3; clock++ {
+		if err := store.Append(signedBlock(clock, key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	// a complete record with a clock already passed is not a crash artifact
+	name := filepath.Join(dir, "00000000"+segmentExtension)
+	payload := signedBlock(1, key).Serialize()
+	record := make([]byte, headerSize, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(append(record, payload...))
+	file.Close()
+	before, _ := os.Stat(name)
+
+	if _, err := Open(dir, 0); err != ErrOutOfOrder {
+		t.Fatalf("expected ErrOutOfOrder, got %v", err)
+	}
+	if after, _ := os.Stat(name); after.Size() != before.Size() {
+		t.Error("segment truncated on out of order record")
+	}
+}
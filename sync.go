@@ -0,0 +1,452 @@
+package swell
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/util"
+)
+
+// Fast sync of new nodes. A node serves the snapshot of its state at a
+// checkpoint split into chunks of SnapshotChunkSize bytes. The manifest of the
+// snapshot lists the hashes of the chunks, whose concatenation hashes to the
+// state checksum, and carries the finalized block of the checkpoint and the
+// serialized validator registry. The checksum of the manifest is their
+// CheckpointChecksum. The manifest also carries the older finalized blocks
+// that fix the seed anchors of the checkpoint epochs (see SeedBlocks), which
+// are trusted by their quorum of signatures. A syncing node that trusts the checksum of a checkpoint
+// verifies the manifest against it and every chunk against the manifest,
+// downloads the chunks in parallel from several peers, restores the state and
+// the registry on top of the checkpoint block and then replays the blocks
+// after it.
+
+const (
+	SnapshotChunkSize = 1 << 15
+	maxSyncBlocks     = 256
+)
+
+var (
+	ErrSyncPeers      = errors.New("no peer could serve the snapshot")
+	ErrSyncIncomplete = errors.New("snapshot download is incomplete")
+	ErrSyncBlocks     = errors.New("no peer could serve valid blocks")
+	ErrSyncAnchors    = errors.New("snapshot seed blocks not signed by a quorum")
+)
+
+func snapshotChunks(data []byte) [][]byte {
+	chunks := make([][]byte, 0, len(data)/SnapshotChunkSize+1)
+	for start := 0; start < len(data); start += SnapshotChunkSize {
+		end := start + SnapshotChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunks = append(chunks, data[start:end])
+	}
+	return chunks
+}
+
+func chunksChecksum(hashes []crypto.Hash) crypto.Hash {
+	data := make([]byte, 0, len(hashes)*crypto.Size)
+	for _, hash := range hashes {
+		data = append(data, hash[:]...)
+	}
+	return crypto.Hasher(data)
+}
+
+// SnapshotChecksum returns the checksum of the snapshot data.
+func SnapshotChecksum(data []byte) crypto.Hash {
+	chunks := snapshotChunks(data)
+	hashes := make([]crypto.Hash, len(chunks))
+	for n, chunk := range chunks {
+		hashes[n] = crypto.Hasher(chunk)
+	}
+	return chunksChecksum(hashes)
+}
+
+// CheckpointChecksum binds the checksum of the state at a checkpoint to the
+// hash of the finalized block of the checkpoint, crypto.ZeroHash if there is
+// none, and to the serialized validator registry, empty if the chain has
+// none. It is the checksum validators sign and syncing nodes trust.
+func CheckpointChecksum(state, checkpoint crypto.Hash, registry []byte) crypto.Hash {
+	data := append(state[:], checkpoint[:]...)
+	registryHash := crypto.Hasher(registry)
+	return crypto.Hasher(append(data, registryHash[:]...))
+}
+
+// SerializeRegistry returns the serialized registry of chain, or nil if it
+// has none.
+func SerializeRegistry(chain *BlockChain) []byte {
+	if chain.Registry == nil {
+		return nil
+	}
+	return chain.Registry.Serialize()
+}
+
+type SnapshotManifest struct {
+	Clock      uint64
+	Checkpoint *SignedBlock // block of Clock, nil if not finalized by the chain
+	Anchors    SignedBlocks // blocks older than Clock fixing the seed anchors
+	Registry   []byte       // serialized validator registry, empty if none
+	Chunks     []crypto.Hash
+}
+
+func (m *SnapshotManifest) Checksum() crypto.Hash {
+	checkpoint := crypto.ZeroHash
+	if m.Checkpoint != nil {
+		checkpoint = m.Checkpoint.Block.Hash()
+	}
+	return CheckpointChecksum(chunksChecksum(m.Chunks), checkpoint, m.Registry)
+}
+
+func (m *SnapshotManifest) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(m.Clock, &bytes)
+	checkpoint := make([]byte, 0)
+	if m.Checkpoint != nil {
+		checkpoint = m.Checkpoint.Serialize()
+	}
+	util.PutUint32(uint32(len(checkpoint)), &bytes)
+	bytes = append(bytes, checkpoint...)
+	anchors := m.Anchors.Serialize()
+	util.PutUint32(uint32(len(anchors)), &bytes)
+	bytes = append(bytes, anchors...)
+	util.PutUint32(uint32(len(m.Registry)), &bytes)
+	bytes = append(bytes, m.Registry...)
+	util.PutUint32(uint32(len(m.Chunks)), &bytes)
+	for _, hash := range m.Chunks {
+		util.PutHash(hash, &bytes)
+	}
+	return bytes
+}
+
+func ParseSnapshotManifest(data []byte) *SnapshotManifest {
+	manifest := SnapshotManifest{}
+	position := 0
+	var length, count uint32
+	manifest.Clock, position = util.ParseUint64(data, position)
+	length, position = util.ParseUint32(data, position)
+	if position+int(length) > len(data) {
+		return nil
+	}
+	if length > 0 {
+		manifest.Checkpoint = ParseSignedBlock(data[position : position+int(length)])
+		if manifest.Checkpoint == nil || manifest.Checkpoint.Block.Clock != manifest.Clock {
+			return nil
+		}
+		position += int(length)
+	}
+	length, position = util.ParseUint32(data, position)
+	if position+int(length) > len(data) {
+		return nil
+	}
+	if manifest.Anchors = ParseSignedBlocks(data[position : position+int(length)]); manifest.Anchors == nil {
+		return nil
+	}
+	position += int(length)
+	length, position = util.ParseUint32(data, position)
+	if position+int(length) > len(data) {
+		return nil
+	}
+	manifest.Registry = data[position : position+int(length)]
+	position += int(length)
+	count, position = util.ParseUint32(data, position)
+	if position+int(count)*crypto.Size != len(data) {
+		return nil
+	}
+	manifest.Chunks = make([]crypto.Hash, count)
+	for n := 0; n < int(count); n++ {
+		manifest.Chunks[n], position = util.ParseHash(data, position)
+	}
+	return &manifest
+}
+
+// SnapshotServer serves the manifest and chunks of a snapshot and the blocks
+// of a chain to syncing peers.
+type SnapshotServer struct {
+	manifest *SnapshotManifest
+	chunks   [][]byte
+}
+
+// NewSnapshotServer serves snapshot on top of checkpoint, the finalized
+// block of the snapshot clock or nil if there is none, with the blocks fixing
+// the seed anchors of its epochs and the serialized validator registry of the
+// chain.
+func NewSnapshotServer(snapshot *Snapshot, checkpoint *SignedBlock, anchors SignedBlocks, registry []byte) *SnapshotServer {
+	server := SnapshotServer{
+		manifest: &SnapshotManifest{Clock: snapshot.Clock, Checkpoint: checkpoint, Anchors: anchors, Registry: registry},
+		chunks:   snapshotChunks(snapshot.Data),
+	}
+	server.manifest.Chunks = make([]crypto.Hash, len(server.chunks))
+	for n, chunk := range server.chunks {
+		server.manifest.Chunks[n] = crypto.Hasher(chunk)
+	}
+	return &server
+}
+
+func (s *SnapshotServer) Clock() uint64 {
+	return s.manifest.Clock
+}
+
+// Serve returns the response to request, or nil if it cannot be served.
+// Blocks are served from chain, at most maxSyncBlocks per request.
+func (s *SnapshotServer) Serve(request SyncRequest, chain *BlockChain) []byte {
+	switch request.Kind {
+	case SyncManifest:
+		if request.Clock == s.manifest.Clock {
+			return s.manifest.Serialize()
+		}
+	case SyncChunk:
+		if request.Clock == s.manifest.Clock && int(request.Index) < len(s.chunks) {
+			return s.chunks[request.Index]
+		}
+	case SyncBlocks:
+		blocks := make(SignedBlocks, 0)
+		for _, signed := range chain.RecentBlocks {
+			if signed.Block.Clock > request.Clock {
+				blocks = append(blocks, signed)
+				if len(blocks) == maxSyncBlocks {
+					break
+				}
+			}
+		}
+		return blocks.Serialize()
+	}
+	return nil
+}
+
+// SyncServer answers the requests of syncing peers on behalf of the engine
+// running chain. It must be used from the engine goroutine.
+type SyncServer struct {
+	chain    *BlockChain
+	snapshot *SnapshotServer
+}
+
+func NewSyncServer(chain *BlockChain) *SyncServer {
+	return &SyncServer{chain: chain}
+}
+
+// Serve returns the response to request. A snapshot of the state is taken
+// at the first request and when a peer asks for the manifest of a newer
+// checkpoint after the tip moved past the snapshot, so that peers cannot make
+// the node take more than one snapshot per finalized block.
+func (s *SyncServer) Serve(request SyncRequest) []byte {
+	_, tip := s.chain.Tip()
+	if s.snapshot == nil || request.Kind == SyncManifest && request.Clock > s.snapshot.Clock() && tip > s.snapshot.Clock() {
+		snapshot := s.chain.CurrentState.Snapshot()
+		s.snapshot = NewSnapshotServer(snapshot, s.chain.Finalized(snapshot.Clock), s.chain.SeedBlocks(snapshot.Clock), SerializeRegistry(s.chain))
+	}
+	return s.snapshot.Serve(request, s.chain)
+}
+
+// SyncPeer is a connection to a peer able to serve sync requests.
+type SyncPeer interface {
+	Request(kind byte, clock uint64, index uint32) ([]byte, error)
+}
+
+// Syncer downloads the snapshot of the state at a trusted checkpoint. The
+// chunks already downloaded are kept, so a download interrupted by peer
+// disconnections is resumed by calling Download again.
+type Syncer struct {
+	mu       sync.Mutex
+	clock    uint64
+	checksum crypto.Hash
+	manifest *SnapshotManifest
+	chunks   [][]byte
+	missing  int
+}
+
+// NewSyncer prepares the download of the snapshot at clock whose state
+// checksum is trusted to be checksum.
+func NewSyncer(clock uint64, checksum crypto.Hash) *Syncer {
+	return &Syncer{clock: clock, checksum: checksum}
+}
+
+// Progress returns the number of chunks downloaded and the total number of
+// chunks, or zero if the manifest is not yet known.
+func (s *Syncer) Progress() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.chunks) - s.missing, len(s.chunks)
+}
+
+func (s *Syncer) fetchManifest(peers []SyncPeer) bool {
+	for _, peer := range peers {
+		data, err := peer.Request(SyncManifest, s.clock, 0)
+		if err != nil {
+			continue
+		}
+		manifest := ParseSnapshotManifest(data)
+		if manifest != nil && manifest.Clock == s.clock && manifest.Checksum() == s.checksum {
+			s.manifest = manifest
+			s.chunks = make([][]byte, len(manifest.Chunks))
+			s.missing = len(manifest.Chunks)
+			return true
+		}
+	}
+	return false
+}
+
+// Download fetches every missing chunk with at most parallel requests in
+// flight, spread among peers. A chunk that fails to download or to verify is
+// retried with another peer and the failing peer is not used again during the
+// call. It returns ErrSyncPeers if every peer failed before the download was
+// complete.
+func (s *Syncer) Download(peers []SyncPeer, parallel int) error {
+	if s.manifest == nil && !s.fetchManifest(peers) {
+		return ErrSyncPeers
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+	alive := make([]SyncPeer, len(peers))
+	copy(alive, peers)
+	next := 0
+	pick := func() SyncPeer {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if len(alive) == 0 {
+			return nil
+		}
+		next = (next + 1) % len(alive)
+		return alive[next]
+	}
+	drop := func(peer SyncPeer) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for n, candidate := range alive {
+			if candidate == peer {
+				alive = append(alive[:n], alive[n+1:]...)
+				return
+			}
+		}
+	}
+	for {
+		jobs := make(chan uint32, len(s.chunks))
+		for n, chunk := range s.chunks {
+			if chunk == nil {
+				jobs <- uint32(n)
+			}
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+		var wg sync.WaitGroup
+		for worker := 0; worker < parallel; worker++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					var index uint32
+					select {
+					case index = <-jobs:
+					default:
+						return
+					}
+					peer := pick()
+					if peer == nil {
+						return
+					}
+					data, err := peer.Request(SyncChunk, s.clock, index)
+					if err != nil || crypto.Hasher(data) != s.manifest.Chunks[index] {
+						drop(peer)
+						jobs <- index
+						continue
+					}
+					s.mu.Lock()
+					s.chunks[index] = data
+					s.missing -= 1
+					s.mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		s.mu.Lock()
+		exhausted := len(alive) == 0 && s.missing > 0
+		s.mu.Unlock()
+		if exhausted {
+			return ErrSyncPeers
+		}
+	}
+}
+
+// Restore replaces the state of chain by the downloaded snapshot and makes
+// its checkpoint block the tip of chain, after the blocks fixing the seed
+// anchors. If both chain and the snapshot have a validator registry, the
+// registry of chain is restored as well.
+func (s *Syncer) Restore(chain *BlockChain) error {
+	if s.manifest == nil || s.missing > 0 {
+		return ErrSyncIncomplete
+	}
+	data := make([]byte, 0, len(s.chunks)*SnapshotChunkSize)
+	for _, chunk := range s.chunks {
+		data = append(data, chunk...)
+	}
+	if chain.Registry != nil && len(s.manifest.Registry) > 0 {
+		if err := chain.Registry.Restore(s.manifest.Registry); err != nil {
+			return err
+		}
+	}
+	for n, anchor := range s.manifest.Anchors {
+		if anchor.Block.Clock >= s.clock || n > 0 && anchor.Block.Clock <= s.manifest.Anchors[n-1].Block.Clock || !chain.VerifyQuorum(anchor) {
+			return ErrSyncAnchors
+		}
+	}
+	if err := chain.CurrentState.Restore(&Snapshot{Clock: s.clock, Data: data}); err != nil {
+		return err
+	}
+	chain.RecentBlocks = append(make(SignedBlocks, 0), s.manifest.Anchors...)
+	if s.manifest.Checkpoint != nil {
+		chain.RecentBlocks = append(chain.RecentBlocks, s.manifest.Checkpoint)
+	}
+	chain.CandidateBlocks = make(map[uint64]SignedBlocks)
+	chain.Epoch = s.clock
+	if chain.Registry != nil {
+		set := chain.Registry.At(s.clock + 1)
+		chain.Validators, chain.TotalStake = set.Validators, set.TotalStake
+	}
+	return nil
+}
+
+// Replay fetches from peers the blocks after the snapshot and incorporates
+// them into chain until the tip known by the peers is reached. Every block
+// must carry a valid quorum of signatures and extend the previous one, the
+// first one the checkpoint block.
+func (s *Syncer) Replay(chain *BlockChain, peers []SyncPeer) error {
+	for _, peer := range peers {
+		for {
+			_, clock := chain.Tip()
+			data, err := peer.Request(SyncBlocks, clock, 0)
+			if err != nil {
+				break
+			}
+			blocks := ParseSignedBlocks(data)
+			if blocks == nil {
+				break
+			}
+			if len(blocks) == 0 {
+				return nil
+			}
+			if !s.incorporate(chain, blocks) {
+				break
+			}
+		}
+	}
+	return ErrSyncBlocks
+}
+
+func (s *Syncer) incorporate(chain *BlockChain, blocks SignedBlocks) bool {
+	for _, signed := range blocks {
+		parent, clock := chain.Tip()
+		if signed.Block.Clock <= clock || signed.Block.Parent != parent || !chain.VerifyQuorum(signed) {
+			return false
+		}
+		overlay := ValidateBlock(chain.CurrentState, nil, signed.Block, chain.Params)
+		if overlay == nil {
+			return false
+		}
+		if chain.Commit(signed, overlay) != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,263 @@
+package swell
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+type bytesState struct {
+	clock uint64
+	data  []byte
+}
+
+type bytesOverlay struct {
+	clock uint64
+	data  []byte
+}
+
+func (o *bytesOverlay) Clock() uint64 { return o.clock }
+
+func (o *bytesOverlay) Apply(event Event) bool {
+	o.data = append(o.data, event...)
+	return true
+}
+
+func (s *bytesState) LastCheckPoint() Checkpoint { return nil }
+
+func (s *bytesState) ChecksumJob() chan crypto.Hash { return nil }
+
+func (s *bytesState) Validate(event Event) bool { return true }
+
+func (s *bytesState) Overlay(parent Overlay, clock uint64) Overlay {
+	return &bytesOverlay{clock: clock}
+}
+
+func (s *bytesState) Commit(overlay Overlay) error {
+	s.clock = overlay.Clock()
+	s.data = append(s.data, overlay.(*bytesOverlay).data...)
+	return nil
+}
+
+func (s *bytesState) Rollback(overlay Overlay) {}
+
+func (s *bytesState) Snapshot() *Snapshot {
+	return &Snapshot{Clock: s.clock, Data: append([]byte{}, s.data...)}
+}
+
+func (s *bytesState) Restore(snapshot *Snapshot) error {
+	s.clock, s.data = snapshot.Clock, append([]byte{}, snapshot.Data...)
+	return nil
+}
+
+// testPeer serves requests from server and fails after failAfter requests.
+type testPeer struct {
+	server    *SnapshotServer
+	chain     *BlockChain
+	failAfter int
+	requests  int
+}
+
+func (p *testPeer) Request(kind byte, clock uint64, index uint32) ([]byte, error) {
+	p.requests += 1
+	if p.failAfter > 0 && p.requests > p.failAfter {
+		return nil, errors.New("disconnected")
+	}
+	if response := p.server.Serve(SyncRequest{Kind: kind, Clock: clock, Index: index}, p.chain); response != nil {
+		return response, nil
+	}
+	return nil, errors.New("not available")
+}
+
+// signedBlock returns a block of clock on top of parent signed by key as
+// publisher and single validator.
+func signedBlock(key crypto.PrivateKey, clock uint64, parent crypto.Hash) *SignedBlock {
+	block := &Block{Clock: clock, Parent: parent, Publisher: key.PublicKey(), PublishedAt: time.Now(), Events: Events{Event{byte(clock)}}}
+	block.Sign(key)
+	hash := block.Hash()
+	signature := Signature{Hash: hash, Token: key.PublicKey(), Signature: key.Sign(hash[:])}
+	return &SignedBlock{Block: block, Signatures: []Signature{signature}}
+}
+
+func TestSnapshotSync(t *testing.T) {
+	token, _ := crypto.RandomAsymetricKey()
+	validators := []Validator{{Token: token, Stake: 10}}
+	// the blocks after the snapshot are signed by a validator that joined
+	// before it
+	_, joined := crypto.RandomAsymetricKey()
+	registry := NewValidatorRegistry(validators, 0)
+	if err := registry.Deposit(5, joined.PublicKey(), 100); err != nil {
+		t.Fatal(err)
+	}
+	state := &bytesState{clock: 10, data: make([]byte, 5*SnapshotChunkSize+100)}
+	for n := range state.data {
+		state.data[n] = byte(n * 7)
+	}
+	source := &BlockChain{Registry: registry, CurrentState: state}
+	checkpoint := signedBlock(joined, 10, crypto.ZeroValueHash)
+	source.Finalize(checkpoint)
+	snapshot := state.Snapshot()
+	checksum := CheckpointChecksum(SnapshotChecksum(snapshot.Data), checkpoint.Block.Hash(), registry.Serialize())
+	server := NewSnapshotServer(snapshot, checkpoint, nil, registry.Serialize())
+	parent := checkpoint.Block.Hash()
+	for clock := uint64(11); clock <= 13; clock++ {
+		signed := signedBlock(joined, clock, parent)
+		source.Finalize(signed)
+		parent = signed.Block.Hash()
+	}
+
+	bad := &testPeer{server: NewSnapshotServer(&Snapshot{Clock: 10, Data: []byte{1, 2, 3}}, checkpoint, nil, registry.Serialize()), chain: source}
+	flaky := &testPeer{server: server, chain: source, failAfter: 3}
+	syncer := NewSyncer(10, checksum)
+	// the manifest binds the checkpoint block and the registry
+	forged := []*SnapshotServer{
+		NewSnapshotServer(snapshot, signedBlock(joined, 10, crypto.ZeroHash), nil, registry.Serialize()),
+		NewSnapshotServer(snapshot, checkpoint, nil, NewValidatorRegistry(validators, 0).Serialize()),
+	}
+	for _, server := range forged {
+		if err := NewSyncer(10, checksum).Download([]SyncPeer{&testPeer{server: server, chain: source}}, 1); err != ErrSyncPeers {
+			t.Fatalf("expected forged manifest to be rejected, got %v", err)
+		}
+	}
+	if err := syncer.Download([]SyncPeer{bad, flaky}, 2); err != ErrSyncPeers {
+		t.Fatalf("expected download to stop when peers are gone, got %v", err)
+	}
+	done, total := syncer.Progress()
+	if total != 6 || done == 0 || done == total {
+		t.Fatalf("unexpected progress %v of %v", done, total)
+	}
+	good := &testPeer{server: server, chain: source}
+	if err := syncer.Download([]SyncPeer{bad, good}, 3); err != nil {
+		t.Fatal(err)
+	}
+	synced := &BlockChain{Registry: NewValidatorRegistry(validators, 0), CurrentState: &bytesState{}}
+	if err := syncer.Restore(synced); err != nil {
+		t.Fatal(err)
+	}
+	if hash, clock := synced.Tip(); clock != 10 || hash != checkpoint.Block.Hash() {
+		t.Fatal("checkpoint block is not the tip of the restored chain")
+	}
+	if !synced.IsValidator(crypto.HashToken(joined.PublicKey())) || synced.ValidatorSet(3).Stake(joined.PublicKey()) != 0 {
+		t.Fatal("validator registry not restored")
+	}
+	// blocks that do not extend the checkpoint are rejected
+	fork := &BlockChain{CurrentState: &bytesState{}}
+	fork.Finalize(signedBlock(joined, 11, crypto.ZeroValueHash))
+	if err := syncer.Replay(synced, []SyncPeer{&testPeer{server: server, chain: fork}}); err != ErrSyncBlocks {
+		t.Fatalf("expected blocks off the checkpoint to be rejected, got %v", err)
+	}
+	if err := syncer.Replay(synced, []SyncPeer{good}); err != nil {
+		t.Fatal(err)
+	}
+	if hash, clock := synced.Tip(); clock != 13 || hash != parent {
+		t.Fatalf("replay did not reach the tip: clock %v", clock)
+	}
+	if !bytes.Equal(synced.CurrentState.Snapshot().Data, append(snapshot.Data, 11, 12, 13)) {
+		t.Fatal("synced state differs from source")
+	}
+}
+
+// countingState counts the snapshots taken.
+type countingState struct {
+	bytesState
+	snapshots int
+}
+
+func (s *countingState) Snapshot() *Snapshot {
+	s.snapshots += 1
+	return s.bytesState.Snapshot()
+}
+
+func TestSyncServerSnapshots(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	state := &countingState{}
+	chain := &BlockChain{CurrentState: state}
+	server := NewSyncServer(chain)
+	for n := 0; n < 3; n++ {
+		server.Serve(SyncRequest{Kind: SyncManifest, Clock: 1000})
+	}
+	if state.snapshots != 1 {
+		t.Fatalf("%v snapshots taken without new blocks", state.snapshots)
+	}
+	signed := signedBlock(key, 1, chain.GenesisHash)
+	chain.Commit(signed, &bytesOverlay{clock: 1})
+	manifest := ParseSnapshotManifest(server.Serve(SyncRequest{Kind: SyncManifest, Clock: 1}))
+	if state.snapshots != 2 || manifest == nil || manifest.Checkpoint == nil || manifest.Checkpoint.Block.Hash() != signed.Block.Hash() {
+		t.Fatal("snapshot not taken at the new tip")
+	}
+}
+
+func TestSeedAnchors(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	validators := []Validator{{Token: key.PublicKey(), Stake: 10}}
+	source := &BlockChain{EpochSlots: 10, TotalStake: 10, Validators: validators, CurrentState: &bytesState{}}
+	hashes := make(map[uint64]crypto.Hash)
+	parent, checkpoint := source.Tip()
+	// no block is finalized for the slots just after the first boundary
+	for clock := uint64(1); clock <= 35; clock++ {
+		if clock >= 10 && clock < 13 {
+			continue
+		}
+		block := &Block{Clock: clock, Parent: parent, CheckPoint: checkpoint, Publisher: key.PublicKey(), PublishedAt: time.Now()}
+		block.Sign(key)
+		hash := block.Hash()
+		source.Commit(&SignedBlock{Block: block, Signatures: []Signature{{Hash: hash, Token: key.PublicKey(), Signature: key.Sign(hash[:])}}}, &bytesOverlay{clock: clock})
+		parent, checkpoint, hashes[clock] = hash, clock, hash
+		if clock != 25 {
+			continue
+		}
+		if hash, ok := source.SeedAnchor(2); !ok || hash != hashes[9] {
+			t.Fatal("wrong seed anchor of epoch 2")
+		}
+		seeds := source.SeedBlocks(25)
+		if len(seeds) != 2 || seeds[0].Block.Clock != 13 || seeds[1].Block.Clock != 20 {
+			t.Fatal("wrong seed blocks of the snapshot")
+		}
+	}
+	for epoch, anchor := range []crypto.Hash{crypto.ZeroHash, crypto.ZeroHash, crypto.ZeroHash, hashes[19], hashes[29], hashes[35]} {
+		if hash, ok := source.SeedAnchor(uint64(epoch)); ok != (epoch != 2) || hash != anchor {
+			t.Fatalf("wrong seed anchor of epoch %v", epoch)
+		}
+	}
+	// blocks before the epoch preceding the epoch of the tip are pruned
+	if source.RecentBlocks[0].Block.Clock != 20 || len(source.RecentBlocks) != 16 {
+		t.Fatal("recent blocks not pruned")
+	}
+	snapshot := source.CurrentState.Snapshot()
+	checksum := CheckpointChecksum(SnapshotChecksum(snapshot.Data), hashes[35], nil)
+	_, stranger := crypto.RandomAsymetricKey()
+	for _, test := range []struct {
+		anchors SignedBlocks
+		err     error
+	}{
+		{SignedBlocks{signedBlock(stranger, 20, hashes[19])}, ErrSyncAnchors},
+		{SignedBlocks{source.Finalized(30), source.Finalized(20)}, ErrSyncAnchors},
+		{SignedBlocks{source.Finalized(35)}, ErrSyncAnchors},
+		{source.SeedBlocks(35), nil},
+	} {
+		server := NewSnapshotServer(snapshot, source.Finalized(35), test.anchors, nil)
+		syncer := NewSyncer(35, checksum)
+		if err := syncer.Download([]SyncPeer{&testPeer{server: server, chain: source}}, 1); err != nil {
+			t.Fatal(err)
+		}
+		synced := &BlockChain{EpochSlots: 10, TotalStake: 10, Validators: validators, CurrentState: &bytesState{}}
+		if err := syncer.Restore(synced); err != test.err {
+			t.Fatalf("expected %v restoring the seed blocks, got %v", test.err, err)
+		}
+		if test.err != nil {
+			continue
+		}
+		for epoch := uint64(3); epoch < 6; epoch++ {
+			hash, ok := synced.SeedAnchor(epoch)
+			if anchor, _ := source.SeedAnchor(epoch); !ok || hash != anchor {
+				t.Fatalf("seed anchor of epoch %v not restored", epoch)
+			}
+		}
+		if _, ok := synced.SeedAnchor(2); ok {
+			t.Fatal("seed anchor older than the seed blocks known")
+		}
+	}
+}
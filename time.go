@@ -0,0 +1,22 @@
+package swell
+
+import "time"
+
+// TimeSource is the source of time of the consensus engines. Engines read the
+// time and schedule their deadlines only through it, so that they can be
+// driven by a virtual clock (see package simulation).
+type TimeSource interface {
+	Now() time.Time
+	// AfterFunc calls f once d has elapsed. Engines use f only to hand a
+	// message to their own goroutine.
+	AfterFunc(d time.Duration, f func())
+}
+
+type systemTime struct{}
+
+func (systemTime) Now() time.Time { return time.Now() }
+
+func (systemTime) AfterFunc(d time.Duration, f func()) { time.AfterFunc(d, f) }
+
+// SystemTime is the TimeSource of the system clock.
+var SystemTime TimeSource = systemTime{}
@@ -54,7 +54,7 @@ func (s *SignedConnection) read() ([]byte, error) {
 	msg := bytes[0 : len(bytes)-crypto.SignatureSize]
 	var signature crypto.Signature
 	copy(signature[:], bytes[len(bytes)-crypto.SignatureSize:])
-	if !s.token.Verify(msg, signature) {
+	if !s.token.VerifyZIP215(msg, signature) {
 		return nil, ErrInvalidSignature
 	}
 	return msg, nil
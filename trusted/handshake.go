@@ -99,7 +99,7 @@ func PerformClientHandShake(conn net.Conn, prvKey crypto.PrivateKey, remotePub c
 	if subtle.ConstantTimeCompare(remoteToken, remotePub[:]) != 1 {
 		return nil, errCouldNotVerify
 	}
-	if !remotePub.Verify(nonce, remoteSignature) {
+	if !remotePub.VerifyZIP215(nonce, remoteSignature) {
 		return nil, errCouldNotVerify
 	}
 	signature := prvKey.Sign(remoteNonce)
@@ -154,7 +154,7 @@ func PerformServerHandShake(conn net.Conn, prvKey crypto.PrivateKey, validator V
 	}
 	var clientSignature crypto.Signature
 	copy(clientSignature[:], resp)
-	if !remoteToken.Verify(newNonce, clientSignature) {
+	if !remoteToken.VerifyZIP215(newNonce, clientSignature) {
 		return nil, errCouldNotVerify
 	}
 	return &SignedConnection{
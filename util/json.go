@@ -23,7 +23,7 @@ func (j *JSONBuilder) putGeneral(fieldName, value string) {
 }
 
 func (j *JSONBuilder) PutTime(fieldName string, t time.Time) {
-	j.putGeneral(fieldName, t.Format(time.RFC3339))
+	j.putGeneral(fieldName, fmt.Sprintf(`"%v"`, t.Format(time.RFC3339)))
 }
 
 func (j *JSONBuilder) PutUint64(fieldName string, value uint64) {
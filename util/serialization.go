@@ -18,6 +18,10 @@ func PutSignature(sign crypto.Signature, data *[]byte) {
 	*data = append(*data, sign[:]...)
 }
 
+func PutVRFProof(proof crypto.VRFProof, data *[]byte) {
+	*data = append(*data, proof[:]...)
+}
+
 func PutByteArray(b []byte, data *[]byte) {
 	if len(b) == 0 {
 		*data = append(*data, 0, 0)
@@ -39,6 +43,10 @@ func PutUint16(v uint16, data *[]byte) {
 	*data = append(*data, byte(v), byte(v>>8))
 }
 
+func PutUint32(v uint32, data *[]byte) {
+	*data = append(*data, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
 func PutUint64(v uint64, data *[]byte) {
 	b := make([]byte, 8)
 	b[0] = byte(v)
@@ -110,6 +118,15 @@ func PutTokenCiphers(tcs crypto.TokenCiphers, data *[]byte) {
 	}
 }
 
+func ParseVRFProof(data []byte, position int) (crypto.VRFProof, int) {
+	var proof crypto.VRFProof
+	if position+crypto.VRFProofSize > len(data) {
+		return proof, position
+	}
+	copy(proof[:], data[position:position+crypto.VRFProofSize])
+	return proof, position + crypto.VRFProofSize
+}
+
 func ParseSignature(data []byte, position int) (crypto.Signature, int) {
 	var sign crypto.Signature
 	if position+crypto.SignatureSize > len(data) {
@@ -164,6 +181,17 @@ func ParseUint16(data []byte, position int) (uint16, int) {
 	return value, position + 2
 }
 
+func ParseUint32(data []byte, position int) (uint32, int) {
+	if position+3 >= len(data) {
+		return 0, position + 4
+	}
+	value := uint32(data[position+0]) |
+		uint32(data[position+1])<<8 |
+		uint32(data[position+2])<<16 |
+		uint32(data[position+3])<<24
+	return value, position + 4
+}
+
 func ParseUint64(data []byte, position int) (uint64, int) {
 	if position+7 >= len(data) {
 		return 0, position + 8
@@ -179,14 +207,15 @@ func ParseUint64(data []byte, position int) (uint64, int) {
 	return value, position + 8
 }
 
+// ParseTime returns a position past the end of data if the bytes at position
+// are not a valid time.
 func ParseTime(data []byte, position int) (time.Time, int) {
 	bytes, newposition := ParseByteArray(data, position)
 	var t time.Time
 	if err := t.UnmarshalBinary(bytes); err != nil {
-		panic("cannot parse time")
+		return t, len(data) + 1
 	}
 	return t, newposition
-
 }
 
 func ParseBool(data []byte, position int) (bool, int) {
@@ -42,3 +42,11 @@ func TestUint64(t *testing.T) {
 		t.Errorf("Wrong uint64 serialization")
 	}
 }
+
+func TestParseInvalidTime(t *testing.T) {
+	bytes := make([]byte, 0)
+	PutByteArray([]byte{1, 2, 3}, &bytes)
+	if _, position := ParseTime(bytes, 0); position <= len(bytes) {
+		t.Errorf("invalid time parsed")
+	}
+}
@@ -0,0 +1,323 @@
+package swell
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/util"
+)
+
+var (
+	ErrRegistryClock     = errors.New("validator registry change older than the last change")
+	ErrInsufficientStake = errors.New("withdrawal larger than deposited stake")
+	ErrInvalidRegistry   = errors.New("invalid serialized validator registry")
+	ErrMaxTotalStake     = errors.New("stake beyond the maximum total stake")
+)
+
+// MaxTotalStake is the largest total stake of a validator set for which the
+// two thirds quorum arithmetic does not overflow.
+const MaxTotalStake = math.MaxUint64 / 3
+
+// ValidatorSet is the set of validators that can sign the blocks from Clock
+// on, until the next set of a ValidatorRegistry.
+type ValidatorSet struct {
+	Clock      uint64
+	Validators []Validator
+	TotalStake uint64
+}
+
+func NewValidatorSet(clock uint64, validators []Validator) *ValidatorSet {
+	set := &ValidatorSet{Clock: clock, Validators: validators}
+	for _, validator := range validators {
+		set.TotalStake += validator.Stake
+	}
+	return set
+}
+
+// Hash is the hash validators sign to hand the set over to light clients.
+func (s *ValidatorSet) Hash() crypto.Hash {
+	bytes := make([]byte, 0)
+	util.PutUint64(s.Clock, &bytes)
+	putValidators(s.Validators, &bytes)
+	return crypto.Hasher(bytes)
+}
+
+// SetChange is the signature of the hash of Set by a validator of the set it
+// replaces. Engines publish one when a block changes the validator set so
+// that light clients follow it.
+type SetChange struct {
+	Set       *ValidatorSet
+	Signature Signature
+}
+
+// Stake returns the stake of token within the set.
+func (s *ValidatorSet) Stake(token crypto.Token) uint64 {
+	for _, validator := range s.Validators {
+		if validator.Token == token {
+			return validator.Stake
+		}
+	}
+	return 0
+}
+
+// HasQuorum checks if the signatures are from distinct validators holding
+// more than two thirds of the total stake. Signatures are not verified.
+func (s *ValidatorSet) HasQuorum(signatures []Signature) bool {
+	signed := uint64(0)
+	signers := make(map[crypto.Token]struct{})
+	for _, signature := range signatures {
+		if _, ok := signers[signature.Token]; !ok {
+			signers[signature.Token] = struct{}{}
+			signed += s.Stake(signature.Token)
+		}
+	}
+	return 3*signed > 2*s.TotalStake
+}
+
+// QuorumSigned checks that signatures hold valid signatures of hash by
+// distinct validators holding more than two thirds of the total stake.
+func (s *ValidatorSet) QuorumSigned(hash crypto.Hash, signatures []Signature) bool {
+	batch := crypto.NewBatchVerifier()
+	candidates := make([]Signature, 0, len(signatures))
+	for _, signature := range signatures {
+		if signature.Hash == hash {
+			batch.Add(signature.Token, hash[:], signature.Signature)
+			candidates = append(candidates, signature)
+		}
+	}
+	_, verified := batch.Verify()
+	signers := make(map[crypto.Token]struct{})
+	valid := make([]Signature, 0, len(candidates))
+	for n, signature := range candidates {
+		if _, signer := signers[signature.Token]; verified[n] && !signer {
+			signers[signature.Token] = struct{}{}
+			valid = append(valid, signature)
+		}
+	}
+	return s.HasQuorum(valid)
+}
+
+// ValidatorRegistry keeps the history of validator sets. The state machine
+// records deposits and withdrawals of stake as it commits the block of a
+// clock, and they take effect for the blocks after it. At answers which
+// validators could sign the block of any clock since genesis.
+//
+// The registry is carried by the snapshot manifest, so that a node restored
+// by fast sync verifies the blocks after the snapshot with the validator sets
+// of the chain it synced.
+//
+// Only the maxValidators largest stakes, ties broken by token, are part of a
+// set; zero means no limit.
+type ValidatorRegistry struct {
+	mu            sync.RWMutex
+	maxValidators int
+	stakes        map[crypto.Token]uint64
+	sets          []*ValidatorSet
+}
+
+func NewValidatorRegistry(genesis []Validator, maxValidators int) *ValidatorRegistry {
+	registry := &ValidatorRegistry{maxValidators: maxValidators, stakes: make(map[crypto.Token]uint64)}
+	for _, validator := range genesis {
+		registry.stakes[validator.Token] += validator.Stake
+	}
+	registry.sets = []*ValidatorSet{registry.active(0)}
+	return registry
+}
+
+func (r *ValidatorRegistry) active(clock uint64) *ValidatorSet {
+	validators := make([]Validator, 0, len(r.stakes))
+	for token, stake := range r.stakes {
+		validators = append(validators, Validator{Token: token, Stake: stake})
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		if validators[i].Stake != validators[j].Stake {
+			return validators[i].Stake > validators[j].Stake
+		}
+		return bytes.Compare(validators[i].Token[:], validators[j].Token[:]) < 0
+	})
+	if r.maxValidators > 0 && len(validators) > r.maxValidators {
+		validators = validators[:r.maxValidators]
+	}
+	return NewValidatorSet(clock, validators)
+}
+
+// total returns the sum of the stakes, at most MaxTotalStake.
+func (r *ValidatorRegistry) total() uint64 {
+	total := uint64(0)
+	for _, stake := range r.stakes {
+		total += stake
+	}
+	return total
+}
+
+// change applies a stake change recorded at clock, in force from clock + 1.
+func (r *ValidatorRegistry) change(clock uint64, token crypto.Token, deposit bool, amount uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := r.sets[len(r.sets)-1]
+	if clock+1 < last.Clock {
+		return ErrRegistryClock
+	}
+	if deposit {
+		if amount > MaxTotalStake-r.total() {
+			return ErrMaxTotalStake
+		}
+		r.stakes[token] += amount
+	} else {
+		if r.stakes[token] < amount {
+			return ErrInsufficientStake
+		}
+		r.stakes[token] -= amount
+		if r.stakes[token] == 0 {
+			delete(r.stakes, token)
+		}
+	}
+	r.record(clock)
+	return nil
+}
+
+// record records the set of the current stakes, in force from clock + 1.
+func (r *ValidatorRegistry) record(clock uint64) {
+	set := r.active(clock + 1)
+	if last := r.sets[len(r.sets)-1]; last.Clock == clock+1 {
+		r.sets[len(r.sets)-1] = set
+	} else {
+		r.sets = append(r.sets, set)
+	}
+}
+
+// Replace replaces every stake with the ones of validators after the block
+// of clock, for engines that choose the validators themselves.
+func (r *ValidatorRegistry) Replace(clock uint64, validators []Validator) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if clock+1 < r.sets[len(r.sets)-1].Clock {
+		return ErrRegistryClock
+	}
+	stakes, total := make(map[crypto.Token]uint64), uint64(0)
+	for _, validator := range validators {
+		if validator.Stake > MaxTotalStake-total {
+			return ErrMaxTotalStake
+		}
+		stakes[validator.Token] += validator.Stake
+		total += validator.Stake
+	}
+	r.stakes = stakes
+	r.record(clock)
+	return nil
+}
+
+// Deposit adds amount to the stake of token after the block of clock. The
+// total stake of the registry cannot exceed MaxTotalStake.
+func (r *ValidatorRegistry) Deposit(clock uint64, token crypto.Token, amount uint64) error {
+	return r.change(clock, token, true, amount)
+}
+
+// Withdraw removes amount from the stake of token after the block of clock.
+func (r *ValidatorRegistry) Withdraw(clock uint64, token crypto.Token, amount uint64) error {
+	return r.change(clock, token, false, amount)
+}
+
+// At returns the validator set that signs the block of clock.
+func (r *ValidatorRegistry) At(clock uint64) *ValidatorSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n := sort.Search(len(r.sets), func(i int) bool { return r.sets[i].Clock > clock })
+	if n == 0 {
+		return r.sets[0]
+	}
+	return r.sets[n-1]
+}
+
+// validatorSize is the size of a serialized validator.
+const validatorSize = crypto.TokenSize + 8
+
+func putValidators(validators []Validator, data *[]byte) {
+	util.PutUint32(uint32(len(validators)), data)
+	for _, validator := range validators {
+		util.PutToken(validator.Token, data)
+		util.PutUint64(validator.Stake, data)
+	}
+}
+
+func parseValidators(data []byte, position int) ([]Validator, int) {
+	count, position := util.ParseUint32(data, position)
+	if position+int(count)*validatorSize > len(data) {
+		return nil, len(data) + 1
+	}
+	validators := make([]Validator, count)
+	for n := range validators {
+		validators[n].Token, position = util.ParseToken(data, position)
+		validators[n].Stake, position = util.ParseUint64(data, position)
+	}
+	return validators, position
+}
+
+// Serialize encodes the stakes, ordered by token, and the history of
+// validator sets of the registry.
+func (r *ValidatorRegistry) Serialize() []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stakes := make([]Validator, 0, len(r.stakes))
+	for token, stake := range r.stakes {
+		stakes = append(stakes, Validator{Token: token, Stake: stake})
+	}
+	sort.Slice(stakes, func(i, j int) bool { return bytes.Compare(stakes[i].Token[:], stakes[j].Token[:]) < 0 })
+	data := make([]byte, 0)
+	putValidators(stakes, &data)
+	util.PutUint32(uint32(len(r.sets)), &data)
+	for _, set := range r.sets {
+		util.PutUint64(set.Clock, &data)
+		putValidators(set.Validators, &data)
+	}
+	return data
+}
+
+// Restore replaces the stakes and the history of the registry by the ones
+// serialized in data. The limit of validators of the registry is kept.
+func (r *ValidatorRegistry) Restore(data []byte) error {
+	tokens, position := parseValidators(data, 0)
+	stakes, total := make(map[crypto.Token]uint64, len(tokens)), uint64(0)
+	for _, validator := range tokens {
+		stakes[validator.Token] = validator.Stake
+		if validator.Stake > MaxTotalStake-total {
+			return ErrInvalidRegistry
+		}
+		total += validator.Stake
+	}
+	var count uint32
+	count, position = util.ParseUint32(data, position)
+	// a set takes at least its clock and the count of its validators
+	if len(stakes) != len(tokens) || count == 0 || position+int(count)*12 > len(data) {
+		return ErrInvalidRegistry
+	}
+	sets := make([]*ValidatorSet, count)
+	for n := range sets {
+		var clock uint64
+		var validators []Validator
+		clock, position = util.ParseUint64(data, position)
+		validators, position = parseValidators(data, position)
+		if position > len(data) || n > 0 && clock <= sets[n-1].Clock {
+			return ErrInvalidRegistry
+		}
+		total := uint64(0)
+		for _, validator := range validators {
+			if validator.Stake > MaxTotalStake-total {
+				return ErrInvalidRegistry
+			}
+			total += validator.Stake
+		}
+		sets[n] = NewValidatorSet(clock, validators)
+	}
+	if position != len(data) {
+		return ErrInvalidRegistry
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stakes, r.sets = stakes, sets
+	return nil
+}
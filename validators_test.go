@@ -0,0 +1,72 @@
+package swell
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+func TestValidatorRegistry(t *testing.T) {
+	tokens := make([]crypto.Token, 3)
+	for n := range tokens {
+		tokens[n], _ = crypto.RandomAsymetricKey()
+	}
+	registry := NewValidatorRegistry([]Validator{{Token: tokens[0], Stake: 30}, {Token: tokens[1], Stake: 20}}, 2)
+	if err := registry.Deposit(10, tokens[2], 25); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Withdraw(10, tokens[0], 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Withdraw(20, tokens[1], 50); err != ErrInsufficientStake {
+		t.Errorf("expected insufficient stake, got %v", err)
+	}
+	if err := registry.Withdraw(20, tokens[0], 25); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Deposit(5, tokens[1], 1); err != ErrRegistryClock {
+		t.Errorf("expected out of order change error, got %v", err)
+	}
+	if err := registry.Deposit(25, tokens[2], MaxTotalStake); err != ErrMaxTotalStake {
+		t.Errorf("expected deposit beyond the maximum total stake to fail, got %v", err)
+	}
+	if err := registry.Replace(30, []Validator{{Token: tokens[0], Stake: MaxTotalStake}, {Token: tokens[1], Stake: 1}}); err != ErrMaxTotalStake {
+		t.Errorf("expected replacement beyond the maximum total stake to fail, got %v", err)
+	}
+	if err := registry.Replace(30, []Validator{{Token: tokens[1], Stake: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Replace(5, nil); err != ErrRegistryClock {
+		t.Errorf("expected out of order replacement error, got %v", err)
+	}
+	if set := registry.At(11); set.HasQuorum([]Signature{{Token: tokens[0]}, {Token: tokens[0]}}) {
+		t.Error("quorum counted the same validator twice")
+	}
+	restored := NewValidatorRegistry(nil, 2)
+	if err := restored.Restore(registry.Serialize()); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		clock uint64
+		total uint64
+		stake [3]uint64
+	}{
+		{0, 50, [3]uint64{30, 20, 0}},
+		{10, 50, [3]uint64{30, 20, 0}},
+		{11, 50, [3]uint64{25, 0, 25}},
+		{21, 45, [3]uint64{0, 20, 25}},
+		{30, 45, [3]uint64{0, 20, 25}},
+		{1000, 1, [3]uint64{0, 1, 0}},
+	} {
+		for _, set := range []*ValidatorSet{registry.At(test.clock), restored.At(test.clock)} {
+			if set.TotalStake != test.total {
+				t.Errorf("wrong total stake at %v: %v", test.clock, set.TotalStake)
+			}
+			for n, token := range tokens {
+				if set.Stake(token) != test.stake[n] {
+					t.Errorf("wrong stake of validator %v at %v: %v", n, test.clock, set.Stake(token))
+				}
+			}
+		}
+	}
+}
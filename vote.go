@@ -0,0 +1,247 @@
+package swell
+
+import (
+	"github.com/lienkolabs/swell/crypto"
+	"github.com/lienkolabs/swell/util"
+)
+
+// Steps of a round voted on by round based engines.
+const (
+	Prevote byte = iota
+	Precommit
+)
+
+// Vote is the vote of a validator at a step of a round of the consensus for
+// the block of Clock. A vote for the zero hash is a vote for no block.
+//
+// Signature covers the step and the round. On a precommit for a block Commit
+// is also the signature of the CommitHash of the block and the round, so that
+// the precommits that finalize a block form its SignedBlock.
+type Vote struct {
+	Kind      byte
+	Clock     uint64
+	Round     uint32
+	Hash      crypto.Hash
+	Token     crypto.Token
+	Commit    crypto.Signature
+	Signature crypto.Signature
+}
+
+const voteSize = 1 + 8 + 4 + crypto.Size + crypto.TokenSize + 2*crypto.SignatureSize
+
+func NewVote(kind byte, clock uint64, round uint32, hash crypto.Hash, key crypto.PrivateKey) *Vote {
+	vote := &Vote{Kind: kind, Clock: clock, Round: round, Hash: hash, Token: key.PublicKey()}
+	if kind == Precommit && hash != crypto.ZeroValueHash {
+		commit := CommitHash(hash, round)
+		vote.Commit = key.Sign(commit[:])
+	}
+	vote.Signature = key.Sign(vote.serializeToSign())
+	return vote
+}
+
+func (v *Vote) serializeToSign() []byte {
+	bytes := []byte{v.Kind}
+	util.PutUint64(v.Clock, &bytes)
+	util.PutUint32(v.Round, &bytes)
+	util.PutHash(v.Hash, &bytes)
+	util.PutToken(v.Token, &bytes)
+	util.PutSignature(v.Commit, &bytes)
+	return bytes
+}
+
+func (v *Vote) Serialize() []byte {
+	bytes := v.serializeToSign()
+	util.PutSignature(v.Signature, &bytes)
+	return bytes
+}
+
+// Verify checks the vote signature and, on a precommit for a block, the
+// commit signature.
+func (v *Vote) Verify() bool {
+	if v.Kind > Precommit || !v.Token.VerifyZIP215(v.serializeToSign(), v.Signature) {
+		return false
+	}
+	if v.Kind == Precommit && v.Hash != crypto.ZeroValueHash {
+		commit := CommitHash(v.Hash, v.Round)
+		return v.Token.VerifyZIP215(commit[:], v.Commit)
+	}
+	return true
+}
+
+// CommitHash returns the hash signed by the commits of block hash at round.
+// At round 0 it is the block hash itself, as signed by engines without
+// rounds. Later rounds bind the round, so that a validator that precommits
+// different blocks of a clock in different rounds, as round based engines
+// allow, does not produce the signatures of a DoubleSign.
+func CommitHash(hash crypto.Hash, round uint32) crypto.Hash {
+	if round == 0 {
+		return hash
+	}
+	bytes := make([]byte, 0)
+	util.PutHash(hash, &bytes)
+	util.PutUint32(round, &bytes)
+	return crypto.Hasher(bytes)
+}
+
+// CommitSignature returns the commit signature of a precommit.
+func (v *Vote) CommitSignature() Signature {
+	return Signature{Hash: CommitHash(v.Hash, v.Round), Token: v.Token, Signature: v.Commit}
+}
+
+// ParseVote parses a vote and verifies its signatures.
+func ParseVote(data []byte) *Vote {
+	if len(data) != voteSize {
+		return nil
+	}
+	vote := Vote{Kind: data[0]}
+	position := 1
+	vote.Clock, position = util.ParseUint64(data, position)
+	vote.Round, position = util.ParseUint32(data, position)
+	vote.Hash, position = util.ParseHash(data, position)
+	vote.Token, position = util.ParseToken(data, position)
+	vote.Commit, position = util.ParseSignature(data, position)
+	vote.Signature, _ = util.ParseSignature(data, position)
+	if !vote.Verify() {
+		return nil
+	}
+	return &vote
+}
+
+// QuorumCertificate holds the signatures of the block Hash of Clock by
+// validators holding more than two thirds of the stake. Before any block the
+// certificate of the genesis has no signatures.
+type QuorumCertificate struct {
+	Clock      uint64
+	Hash       crypto.Hash
+	Signatures []Signature
+}
+
+const signatureSize = crypto.Size + crypto.TokenSize + crypto.SignatureSize
+
+func (q *QuorumCertificate) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(q.Clock, &bytes)
+	util.PutHash(q.Hash, &bytes)
+	util.PutUint16(uint16(len(q.Signatures)), &bytes)
+	for _, signature := range q.Signatures {
+		bytes = append(bytes, signature.Serialize()...)
+	}
+	return bytes
+}
+
+// Verify checks that the certificate is signed by a quorum of set.
+func (q *QuorumCertificate) Verify(set *ValidatorSet) bool {
+	return set.QuorumSigned(q.Hash, q.Signatures)
+}
+
+func parseQuorumCertificate(data []byte, position int) (*QuorumCertificate, int) {
+	certificate := QuorumCertificate{}
+	var count uint16
+	certificate.Clock, position = util.ParseUint64(data, position)
+	certificate.Hash, position = util.ParseHash(data, position)
+	count, position = util.ParseUint16(data, position)
+	if position+int(count)*signatureSize > len(data) {
+		return nil, position
+	}
+	certificate.Signatures = make([]Signature, count)
+	for n := range certificate.Signatures {
+		certificate.Signatures[n] = *ParseSignature(data[position : position+signatureSize])
+		position += signatureSize
+	}
+	return &certificate, position
+}
+
+func ParseQuorumCertificate(data []byte) *QuorumCertificate {
+	certificate, position := parseQuorumCertificate(data, 0)
+	if certificate == nil || position != len(data) {
+		return nil
+	}
+	return certificate
+}
+
+// Proposal proposes Block for a round of the consensus of the block clock.
+// The proposer of the round is not necessarily the block publisher: a block
+// seen with a quorum of prevotes in ValidRound is proposed again in later
+// rounds. ValidRound is -1 for a new block.
+//
+// Engines whose blocks are certified one on top of the other carry in
+// Justify the certificate of the parent block.
+type Proposal struct {
+	Round      uint32
+	ValidRound int32
+	Block      *Block
+	Justify    *QuorumCertificate
+	Token      crypto.Token
+	Signature  crypto.Signature
+}
+
+// proposalSize is the size of a serialized proposal without its block and
+// certificate.
+const proposalSize = 4 + 4 + crypto.Size + crypto.TokenSize + crypto.SignatureSize + 1
+
+func NewProposal(round uint32, validRound int32, block *Block, justify *QuorumCertificate, key crypto.PrivateKey) *Proposal {
+	proposal := &Proposal{Round: round, ValidRound: validRound, Block: block, Justify: justify, Token: key.PublicKey()}
+	proposal.Signature = key.Sign(proposal.serializeToSign())
+	return proposal
+}
+
+func (p *Proposal) serializeToSign() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint32(p.Round, &bytes)
+	util.PutUint32(uint32(p.ValidRound), &bytes)
+	util.PutHash(p.Block.Hash(), &bytes)
+	util.PutToken(p.Token, &bytes)
+	return bytes
+}
+
+// Serialize encodes the proposal followed by the certificate, if any, and by
+// the serialized block.
+func (p *Proposal) Serialize() []byte {
+	bytes := p.serializeToSign()
+	util.PutSignature(p.Signature, &bytes)
+	if p.Justify == nil {
+		bytes = append(bytes, 0)
+	} else {
+		bytes = append(append(bytes, 1), p.Justify.Serialize()...)
+	}
+	return append(bytes, p.Block.Serialize()...)
+}
+
+func (p *Proposal) Verify() bool {
+	return p.Block != nil && p.Token.VerifyZIP215(p.serializeToSign(), p.Signature)
+}
+
+// ParseProposal parses a proposal and verifies its signature and the one of
+// its block. The certificate is not verified.
+func ParseProposal(data []byte) *Proposal {
+	if len(data) <= proposalSize {
+		return nil
+	}
+	position := 0
+	proposal := Proposal{}
+	var validRound uint32
+	proposal.Round, position = util.ParseUint32(data, position)
+	validRound, position = util.ParseUint32(data, position)
+	proposal.ValidRound = int32(validRound)
+	var hash crypto.Hash
+	hash, position = util.ParseHash(data, position)
+	proposal.Token, position = util.ParseToken(data, position)
+	proposal.Signature, position = util.ParseSignature(data, position)
+	if data[position] == 1 {
+		if proposal.Justify, position = parseQuorumCertificate(data, position+1); proposal.Justify == nil {
+			return nil
+		}
+	} else {
+		position += 1
+	}
+	if position >= len(data) {
+		return nil
+	}
+	if proposal.Block = ParseBlock(data[position:]); proposal.Block == nil || proposal.Block.Hash() != hash {
+		return nil
+	}
+	if !proposal.Verify() {
+		return nil
+	}
+	return &proposal
+}
@@ -0,0 +1,61 @@
+package swell
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/swell/crypto"
+)
+
+func TestVoteSerialization(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	hash := crypto.Hasher([]byte("block"))
+	for _, vote := range []*Vote{
+		NewVote(Prevote, 3, 1, hash, key),
+		NewVote(Precommit, 3, 1, hash, key),
+		NewVote(Precommit, 3, 2, crypto.ZeroValueHash, key),
+	} {
+		parsed := ParseVote(vote.Serialize())
+		if parsed == nil || *parsed != *vote {
+			t.Fatal("vote does not round trip")
+		}
+	}
+	vote := NewVote(Precommit, 3, 1, hash, key)
+	if commit := vote.CommitSignature(); commit.Hash != CommitHash(hash, 1) || !commit.Token.VerifyZIP215(commit.Hash[:], commit.Signature) {
+		t.Error("invalid commit signature")
+	}
+	if CommitHash(hash, 0) != hash || CommitHash(hash, 1) == CommitHash(hash, 2) {
+		t.Error("commit hash not bound to the round")
+	}
+	vote.Round = 2
+	if ParseVote(vote.Serialize()) != nil {
+		t.Error("vote with altered round accepted")
+	}
+}
+
+func TestProposalSerialization(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	parent := &Block{Clock: 4, Publisher: token, PublishedAt: time.Unix(4, 0)}
+	parent.Sign(key)
+	hash := parent.Hash()
+	justify := &QuorumCertificate{Clock: 4, Hash: hash, Signatures: []Signature{{Hash: hash, Token: token, Signature: key.Sign(hash[:])}}}
+	block := &Block{Clock: 5, Parent: hash, Publisher: token, PublishedAt: time.Unix(5, 0), Events: Events{newEvent(5, 1)}}
+	block.Sign(key)
+	for _, proposal := range []*Proposal{NewProposal(2, -1, block, nil, key), NewProposal(0, -1, block, justify, key)} {
+		data := proposal.Serialize()
+		parsed := ParseProposal(data)
+		if parsed == nil || !bytes.Equal(parsed.Serialize(), data) {
+			t.Fatal("proposal does not round trip")
+		}
+	}
+	set := NewValidatorSet(0, []Validator{{Token: token, Stake: 1}})
+	if !ParseQuorumCertificate(justify.Serialize()).Verify(set) {
+		t.Error("certificate does not verify")
+	}
+	data := NewProposal(2, 1, block, nil, key).Serialize()
+	data[0] ^= 1
+	if ParseProposal(data) != nil {
+		t.Error("proposal with altered round accepted")
+	}
+}